@@ -0,0 +1,336 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AuditEntry describes a change of an effective config value.
+// Secret values are wrapped in SecretValue: they are never printed or
+// serialized as is. A nil value means the key had no effective value.
+type AuditEntry struct {
+	Key      Key
+	OldValue Value
+	NewValue Value
+	// Provider is the name of the provider serving the new value. If the key
+	// has no effective value anymore, it is the provider which removed it.
+	Provider string
+	Time     time.Time
+}
+
+// MarshalJSON renders the entry as a flat JSON object. Undefined values are
+// omitted.
+func (ae AuditEntry) MarshalJSON() ([]byte, error) {
+	out := struct {
+		Time     time.Time `json:"time"`
+		Key      string    `json:"key"`
+		OldValue Value     `json:"old,omitempty"`
+		NewValue Value     `json:"new,omitempty"`
+		Provider string    `json:"provider,omitempty"`
+	}{
+		Time:     ae.Time,
+		Key:      ae.Key.String(),
+		OldValue: ae.OldValue,
+		NewValue: ae.NewValue,
+		Provider: ae.Provider,
+	}
+	return json.Marshal(out)
+}
+
+// AuditSink receives the changes of the effective config (see
+// RepositoryOptions.AuditSink). Record is called synchronously in the order
+// the changes have been detected.
+type AuditSink interface {
+	Record(AuditEntry) error
+}
+
+// AuditRing is a bounded in-memory AuditSink: once the capacity is reached,
+// the oldest entries are discarded.
+type AuditRing struct {
+	entries []AuditEntry
+	next    int
+	full    bool
+	mx      sync.RWMutex
+}
+
+var _ AuditSink = (*AuditRing)(nil)
+
+// NewAuditRing returns a new instance of AuditRing keeping up to size
+// entries.
+func NewAuditRing(size int) *AuditRing {
+	if size <= 0 {
+		size = 1
+	}
+	return &AuditRing{entries: make([]AuditEntry, size)}
+}
+
+// Record satisfies AuditSink interface.
+func (ar *AuditRing) Record(e AuditEntry) error {
+	ar.mx.Lock()
+	defer ar.mx.Unlock()
+	ar.entries[ar.next] = e
+	ar.next = (ar.next + 1) % len(ar.entries)
+	if ar.next == 0 {
+		ar.full = true
+	}
+	return nil
+}
+
+// Entries returns the kept entries, the oldest first.
+func (ar *AuditRing) Entries() []AuditEntry {
+	return ar.History(nil)
+}
+
+// History returns the kept entries for the key and all it's sub-keys, the
+// oldest first. An empty key matches all entries.
+func (ar *AuditRing) History(key Key) []AuditEntry {
+	ar.mx.RLock()
+	defer ar.mx.RUnlock()
+	res := make([]AuditEntry, 0)
+	start, size := 0, ar.next
+	if ar.full {
+		start, size = ar.next, len(ar.entries)
+	}
+	for ix := 0; ix < size; ix++ {
+		e := ar.entries[(start+ix)%len(ar.entries)]
+		if e.Key.hasPrefix(key) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// JSONLinesAuditSink writes every entry as a single JSON line.
+type JSONLinesAuditSink struct {
+	w  io.Writer
+	mx sync.Mutex
+}
+
+var _ AuditSink = (*JSONLinesAuditSink)(nil)
+
+// NewJSONLinesAuditSink returns a new instance of JSONLinesAuditSink writing
+// to w.
+func NewJSONLinesAuditSink(w io.Writer) *JSONLinesAuditSink {
+	return &JSONLinesAuditSink{w: w}
+}
+
+// Record satisfies AuditSink interface.
+func (js *JSONLinesAuditSink) Record(e AuditEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	js.mx.Lock()
+	defer js.mx.Unlock()
+	_, err = js.w.Write(append(data, '\n'))
+	return err
+}
+
+// FileAuditSink is a JSONLinesAuditSink appending to a file.
+type FileAuditSink struct {
+	*JSONLinesAuditSink
+	file *os.File
+}
+
+// NewFileAuditSink opens the file for appending (the file is created if
+// needed) and returns a new instance of FileAuditSink writing to it.
+func NewFileAuditSink(path string) (*FileAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file %q: %w", path, err)
+	}
+	return &FileAuditSink{
+		JSONLinesAuditSink: NewJSONLinesAuditSink(file),
+		file:               file,
+	}, nil
+}
+
+// Close closes the underlying file.
+func (fs *FileAuditSink) Close() error {
+	return fs.file.Close()
+}
+
+// auditValue is an effective leaf value along with the provider serving it.
+type auditValue struct {
+	value    Value
+	provider string
+}
+
+// auditor tracks the effective leaf values and reports the changes to the
+// sinks.
+type auditor struct {
+	ring   *AuditRing
+	sink   AuditSink
+	values map[string]Value
+	mx     sync.Mutex
+}
+
+func newAuditor(options *RepositoryOptions) *auditor {
+	if options.AuditSink == nil && options.AuditHistorySize <= 0 {
+		return nil
+	}
+	a := &auditor{
+		sink:   options.AuditSink,
+		values: make(map[string]Value),
+	}
+	if options.AuditHistorySize > 0 {
+		a.ring = NewAuditRing(options.AuditHistorySize)
+	}
+	return a
+}
+
+// History returns the recorded changes of the key and all it's sub-keys, the
+// oldest first. Only the last RepositoryOptions.AuditHistorySize changes are
+// kept. Returns nil if the history is disabled.
+// This method is thread safe.
+func (repo *Repository) History(key Key) []AuditEntry {
+	if repo.audit == nil || repo.audit.ring == nil {
+		return nil
+	}
+	return repo.audit.ring.History(key)
+}
+
+// auditChange detects the effective value changes under the keys reported by
+// the provider (nil for a schema change). No keys means the change is
+// global.
+func (repo *Repository) auditChange(prov Provider, keys []Key) {
+	a := repo.audit
+	if a == nil {
+		return
+	}
+	provName := ""
+	if prov != nil {
+		provName = prov.Name()
+	}
+	root := repo.loadRoot()
+	if len(keys) == 0 {
+		keys = []Key{nil}
+	}
+
+	// The values are looked up without waiting for the providers which are
+	// not ready yet (the same way Get does): a provider hanging in SetUp
+	// must not block the change reporting
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	curr, failed := make(map[string]auditValue), make(map[string]bool)
+	prefixes := make([]Key, 0, len(keys))
+	for _, key := range keys {
+		prefix := auditPrefix(root, key)
+		prefixes = append(prefixes, prefix)
+		if ptr := root.find(prefix); ptr != nil {
+			ptr.auditValues(ctx, repo, prefix, curr, failed)
+		}
+	}
+	changed := make([]string, 0)
+	for k, v := range curr {
+		if pv, ok := a.values[k]; !ok || !reflect.DeepEqual(pv, v.value) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range a.values {
+		if _, ok := curr[k]; !ok && !failed[k] && NewKey(k).relatesToAny(prefixes) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+
+	now := time.Now()
+	for _, k := range changed {
+		e := AuditEntry{
+			Key:      NewKey(k),
+			OldValue: a.values[k],
+			Provider: provName,
+			Time:     now,
+		}
+		if v, ok := curr[k]; ok {
+			e.NewValue, e.Provider = v.value, v.provider
+			a.values[k] = v.value
+		} else {
+			delete(a.values, k)
+		}
+		a.record(repo, e)
+	}
+}
+
+func (a *auditor) record(repo *Repository, e AuditEntry) {
+	if a.ring != nil {
+		a.ring.Record(e)
+	}
+	if a.sink != nil {
+		if err := a.sink.Record(e); err != nil {
+			repo.Emit(Event{Type: EventAuditFailed, Provider: e.Provider, Key: e.Key, Err: err})
+		}
+	}
+}
+
+// auditPrefix returns the key prefix the changes should be looked up under:
+// the key itself or the top-most leaf on the key path (a leaf value covers
+// all it's sub-keys).
+func auditPrefix(root *node, key Key) Key {
+	ptr := root
+	for ix, k := range key {
+		next, ok := ptr.children[k]
+		if !ok {
+			break
+		}
+		if len(next.providers) > 0 {
+			return key[:ix+1]
+		}
+		ptr = next
+	}
+	return key
+}
+
+// auditValues collects the effective leaf values the same way dump does.
+// The keys failing the mapping are reported as failed instead of panicking:
+// the audit must never break the change reporting. Their previous values are
+// kept as is.
+func (n *node) auditValues(ctx context.Context, repo *Repository, key Key, res map[string]auditValue, failed map[string]bool) {
+	if strategy := repo.mergeStrategy(key); strategy != MergeReplace && len(n.providers) > 0 {
+		mkv, secret, ok, err := repo.resolveMerged(ctx, n, key, strategy)
+		if err != nil {
+			failed[key.String()] = true
+			return
+		}
+		if ok {
+			val := mkv.Value
+			if secret {
+				val = NewSecretValue(val)
+			}
+			res[key.String()] = auditValue{value: val, provider: n.providers[0].Name()}
+		}
+		return
+	}
+	if n.preferLeaf(repo, key) {
+		for _, prov := range repo.keyProviders(key, n.providers) {
+			mkv, secret, ok, err := repo.doResolve(ctx, prov, key)
+			if err != nil {
+				failed[key.String()] = true
+				return
+			}
+			if !ok {
+				continue
+			}
+			val := mkv.Value
+			if secret {
+				val = NewSecretValue(mkv.Value)
+			}
+			res[key.String()] = auditValue{value: val, provider: prov.Name()}
+			return
+		}
+		return
+	}
+	for k, ch := range n.children {
+		ch.auditValues(ctx, repo, key.child(k), res, failed)
+	}
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// auditSummary renders the entries as key:old->new@provider.
+func auditSummary(entries []AuditEntry) []string {
+	res := make([]string, 0, len(entries))
+	for _, e := range entries {
+		res = append(res, fmt.Sprintf("%s:%v->%v@%s", e.Key, e.OldValue, e.NewValue, e.Provider))
+	}
+	return res
+}
+
+func TestRepositoryAudit(t *testing.T) {
+	src := []byte("db:\n  host: localhost\n  password: secret1\n")
+
+	// Redefining the original value
+	oldReadRaw := readRaw
+	defer func() { readRaw = oldReadRaw }()
+	readRaw = func(source string) (map[interface{}]interface{}, error) {
+		out := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(src, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	buf := &bytes.Buffer{}
+	repo := NewRepositoryWithOptions(&RepositoryOptions{
+		AuditHistorySize: 100,
+		AuditSink:        NewJSONLinesAuditSink(buf),
+	})
+	if err := repo.DefineSchema(map[string]Schema{
+		"db": map[string]Schema{
+			"port":     ToInt,
+			"password": Secret(ToStr),
+		},
+	}); err != nil {
+		t.Fatalf("Failed to define the schema: %s", err)
+	}
+	if _, err := NewDefaultProviderWithDefaults(repo, 0, map[string]Value{"db.port": "5432"}); err != nil {
+		t.Fatalf("Failed to initialize a new default provider: %s", err)
+	}
+	prov, err := NewYamlProviderFromSource(repo, 10, &YamlProviderOptions{}, "dummy.dummy")
+	if err != nil {
+		t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+	}
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+
+	src = []byte("db:\n  host: db.local\n  port: 6432\n  password: secret2\n")
+	if err := prov.reload(); err != nil {
+		t.Fatalf("Failed to reload yaml provider: %s", err)
+	}
+	src = []byte("db:\n  port: 6432\n  password: secret2\n")
+	if err := prov.reload(); err != nil {
+		t.Fatalf("Failed to reload yaml provider: %s", err)
+	}
+	if err := repo.UnregisterProvider("yaml"); err != nil {
+		t.Fatalf("Failed to unregister yaml provider: %s", err)
+	}
+
+	// The providers are set up concurrently: the initial entries order is
+	// not defined
+	want := []string{
+		"db.host:<nil>->localhost@yaml",
+		"db.password:<nil>->******@yaml",
+		"db.port:<nil>->5432@default",
+		// The new key is registered before the change is reported
+		"db.port:5432->6432@yaml",
+		"db.host:localhost->db.local@yaml",
+		"db.password:******->******@yaml",
+		"db.host:db.local-><nil>@yaml",
+		"db.password:******-><nil>@yaml",
+		"db.port:6432->5432@default",
+	}
+	got := auditSummary(repo.History(nil))
+	if len(got) >= 3 {
+		sort.Strings(got[:3])
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected history:\ngot:  %v\nwant: %v", got, want)
+	}
+
+	wantHost := []string{
+		"db.host:<nil>->localhost@yaml",
+		"db.host:localhost->db.local@yaml",
+		"db.host:db.local-><nil>@yaml",
+	}
+	if got := auditSummary(repo.History(NewKey("db.host"))); !reflect.DeepEqual(got, wantHost) {
+		t.Fatalf("Unexpected key history:\ngot:  %v\nwant: %v", got, wantHost)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("Unexpected number of audit lines: got: %d, want: %d", len(lines), len(want))
+	}
+	if strings.Contains(buf.String(), "secret") {
+		t.Fatalf("A secret value leaked into the audit log: %s", buf.String())
+	}
+	wantLine := `"key":"db.password","old":"******","new":"******","provider":"yaml"}`
+	if !strings.HasSuffix(lines[5], wantLine) {
+		t.Fatalf("Unexpected audit line: got: %s, want suffix: %s", lines[5], wantLine)
+	}
+}
+
+func TestAuditRing(t *testing.T) {
+	ring := NewAuditRing(3)
+	for i := 0; i < 5; i++ {
+		ring.Record(AuditEntry{Key: NewKey(fmt.Sprintf("k%d", i%2)), NewValue: i})
+	}
+	want := []string{"k0:<nil>->2@", "k1:<nil>->3@", "k0:<nil>->4@"}
+	if got := auditSummary(ring.Entries()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected entries: got: %v, want: %v", got, want)
+	}
+	want = []string{"k0:<nil>->2@", "k0:<nil>->4@"}
+	if got := auditSummary(ring.History(NewKey("k0"))); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected history: got: %v, want: %v", got, want)
+	}
+}
+
+func TestFileAuditSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config-audit")
+	if err != nil {
+		t.Fatalf("Failed to create a temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileAuditSink(path)
+		if err != nil {
+			t.Fatalf("Failed to open the audit sink: %s", err)
+		}
+		if err := sink.Record(AuditEntry{Key: NewKey("foo"), OldValue: i, NewValue: i + 1, Provider: "env", Time: ts}); err != nil {
+			t.Fatalf("Failed to record an entry: %s", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Failed to close the audit sink: %s", err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read the audit file: %s", err)
+	}
+	want := `{"time":"2020-01-02T03:04:05Z","key":"foo","old":0,"new":1,"provider":"env"}` + "\n" +
+		`{"time":"2020-01-02T03:04:05Z","key":"foo","old":1,"new":2,"provider":"env"}` + "\n"
+	if string(data) != want {
+		t.Fatalf("Unexpected audit file content:\ngot:  %s\nwant: %s", data, want)
+	}
+}
+
+// hangingTestProv registers a key and hangs in SetUp until released. The key
+// value is not available until then.
+type hangingTestProv struct {
+	*TestProv
+	release chan struct{}
+}
+
+func (htp *hangingTestProv) Name() string { return "hanging" }
+
+func (htp *hangingTestProv) SetUp(repo *Repository) error {
+	repo.RegisterKey(NewKey("foo"), htp)
+	<-htp.release
+	return nil
+}
+
+func (htp *hangingTestProv) GetContext(ctx context.Context, key Key) (*KeyValue, bool) {
+	select {
+	case <-htp.release:
+		return htp.Get(key)
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+func TestAuditSetUpHanging(t *testing.T) {
+	repo := NewRepositoryWithOptions(&RepositoryOptions{
+		AuditHistorySize: 100,
+		SetUpTimeout:     50 * time.Millisecond,
+	})
+	hanging := &hangingTestProv{TestProv: NewTestProv(42, 20), release: make(chan struct{})}
+	defer close(hanging.release)
+	repo.RegisterProvider(hanging)
+	// Audits the key served by the hanging provider once set up
+	repo.RegisterProvider(newHookTestProv("fast", []string{}, func() error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}))
+
+	done := make(chan error, 1)
+	go func() { done <- repo.SetUp() }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("Unexpected error: got: %v, want: %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("repo.SetUp() is blocked by the audit")
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"sync"
+)
+
+type cacheEntry struct {
+	kv *KeyValue
+	ok bool
+}
+
+type cacheNode struct {
+	entry    *cacheEntry
+	children map[string]*cacheNode
+}
+
+func newCacheNode() *cacheNode {
+	return &cacheNode{
+		children: make(map[string]*cacheNode),
+	}
+}
+
+// valueCache is a trie-based storage of resolved and mapped values.
+// The trie structure allows precise invalidation: a change of a key value
+// invalidates the key itself, all it's parent keys and all it's sub-keys,
+// leaving the rest of the cache intact.
+type valueCache struct {
+	root *cacheNode
+	// epoch is incremented on every invalidation. It is used to prevent
+	// populating the cache with values resolved before an invalidation.
+	epoch uint64
+	mx    sync.RWMutex
+}
+
+func newValueCache() *valueCache {
+	return &valueCache{
+		root: newCacheNode(),
+	}
+}
+
+// get returns the cached lookup result. The last bool flag indicates
+// whether the key was found in the cache.
+func (c *valueCache) get(key Key) (*KeyValue, bool, bool) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	ptr := c.root
+	for _, k := range key {
+		next, ok := ptr.children[k]
+		if !ok {
+			return nil, false, false
+		}
+		ptr = next
+	}
+	if ptr.entry == nil {
+		return nil, false, false
+	}
+	return ptr.entry.kv, ptr.entry.ok, true
+}
+
+// currentEpoch returns the cache epoch. The result is expected to be
+// obtained before the value resolution and passed to set.
+func (c *valueCache) currentEpoch() uint64 {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return c.epoch
+}
+
+// set stores the lookup result in the cache unless the cache has been
+// invalidated since the epoch.
+func (c *valueCache) set(key Key, kv *KeyValue, ok bool, epoch uint64) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.epoch != epoch {
+		return
+	}
+	ptr := c.root
+	for _, k := range key {
+		if _, ok := ptr.children[k]; !ok {
+			ptr.children[k] = newCacheNode()
+		}
+		ptr = ptr.children[k]
+	}
+	ptr.entry = &cacheEntry{kv: kv, ok: ok}
+}
+
+// invalidate drops cached values for the key, it's parents and it's
+// sub-keys.
+func (c *valueCache) invalidate(key Key) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.epoch++
+	if len(key) == 0 {
+		c.root = newCacheNode()
+		return
+	}
+	ptr := c.root
+	for _, k := range key[:len(key)-1] {
+		ptr.entry = nil
+		next, ok := ptr.children[k]
+		if !ok {
+			return
+		}
+		ptr = next
+	}
+	ptr.entry = nil
+	delete(ptr.children, key[len(key)-1])
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// countingProv counts Get calls in order to tell cache hits from misses.
+type countingProv struct {
+	*TestProv
+	calls int
+}
+
+func (cp *countingProv) Get(key Key) (*KeyValue, bool) {
+	cp.calls++
+	return cp.TestProv.Get(key)
+}
+
+func TestValueCacheInvalidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		invalid   string
+		wantCache []string
+	}{
+		{
+			"Leaf key",
+			"foo.bar.baz",
+			[]string{"foo.moo", "foo.bar.moo", "boo"},
+		},
+		{
+			"Intermediate key",
+			"foo.bar",
+			[]string{"foo.moo", "boo"},
+		},
+		{
+			"Unknown key",
+			"foo.zoo.baz",
+			[]string{"foo.bar", "foo.moo", "foo.bar.baz", "foo.bar.moo", "boo"},
+		},
+		{
+			"Entire cache",
+			"",
+			[]string{},
+		},
+	}
+
+	t.Parallel()
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			keys := []string{"foo", "foo.bar", "foo.moo", "foo.bar.baz", "foo.bar.moo", "boo"}
+			cache := newValueCache()
+			for _, k := range keys {
+				cache.set(NewKey(k), &KeyValue{Key: NewKey(k), Value: k}, true, cache.currentEpoch())
+			}
+			cache.invalidate(NewKey(testCase.invalid))
+			gotCache := make([]string, 0)
+			for _, k := range keys {
+				if _, _, hit := cache.get(NewKey(k)); hit {
+					gotCache = append(gotCache, k)
+				}
+			}
+			wantCache := make([]string, 0)
+			for _, k := range keys {
+				for _, w := range testCase.wantCache {
+					if k == w {
+						wantCache = append(wantCache, k)
+					}
+				}
+			}
+			if !reflect.DeepEqual(gotCache, wantCache) {
+				t.Fatalf("Unexpected cached keys after invalidation of %q: got: %v, want: %v", testCase.invalid, gotCache, wantCache)
+			}
+		})
+	}
+}
+
+func TestValueCacheStaleEpoch(t *testing.T) {
+	cache := newValueCache()
+	key := NewKey("foo")
+	epoch := cache.currentEpoch()
+	cache.invalidate(key)
+	cache.set(key, &KeyValue{Key: key, Value: 1}, true, epoch)
+	if _, _, hit := cache.get(key); hit {
+		t.Fatalf("A value resolved before invalidation is not expected to be cached")
+	}
+}
+
+func TestRepositoryCache(t *testing.T) {
+	repo := NewRepositoryWithOptions(&RepositoryOptions{Cache: true})
+	repo.DefineSchema(map[string]Schema{
+		"system": map[string]Schema{
+			"maxprocs": ToInt,
+		},
+	})
+	prov := &countingProv{TestProv: NewTestProv("4", 10)}
+	repo.RegisterKey(NewKey("system.maxprocs"), prov)
+	other := &countingProv{TestProv: NewTestProv("other", 10)}
+	repo.RegisterKey(NewKey("other"), other)
+
+	assertGet := func(key string, want Value, wantCalls int) {
+		t.Helper()
+		got, ok := repo.Get(NewKey(key))
+		if !ok || !reflect.DeepEqual(got, want) {
+			t.Fatalf("Unexpected value for key %q: got: %#v, want: %#v", key, got, want)
+		}
+		if prov.calls != wantCalls {
+			t.Fatalf("Unexpected number of provider calls: got: %d, want: %d", prov.calls, wantCalls)
+		}
+	}
+
+	assertGet("system", map[string]Value{"maxprocs": 4}, 1)
+	assertGet("system", map[string]Value{"maxprocs": 4}, 1)
+	assertGet("system.maxprocs", 4, 2)
+	assertGet("system.maxprocs", 4, 2)
+	repo.Get(NewKey("other"))
+
+	prov.val = "8"
+	repo.ReportChange(prov, NewKey("system.maxprocs"))
+	assertGet("system", map[string]Value{"maxprocs": 8}, 3)
+	assertGet("system.maxprocs", 8, 4)
+
+	// Unrelated key must stay cached
+	repo.Get(NewKey("other"))
+	if other.calls != 1 {
+		t.Fatalf("Unexpected number of provider calls for an unrelated key: got: %d, want: %d", other.calls, 1)
+	}
+
+	repo.RegisterKey(NewKey("system.maxprocs"), NewTestProv(16, 20))
+	assertGet("system.maxprocs", 16, 4)
+}
+
+func setUpBenchRepo(b *testing.B, options *RepositoryOptions) *Repository {
+	repo := NewRepositoryWithOptions(options)
+	schema := make(map[string]Schema)
+	for i := 0; i < 10; i++ {
+		comp := make(map[string]Schema)
+		for j := 0; j < 10; j++ {
+			comp[fmt.Sprintf("param%d", j)] = ToInt
+			repo.RegisterKey(NewKey(fmt.Sprintf("components.comp%d.param%d", i, j)), NewTestProv("42", 10))
+		}
+		schema[fmt.Sprintf("comp%d", i)] = comp
+	}
+	if err := repo.DefineSchema(map[string]Schema{"components": schema}); err != nil {
+		b.Fatalf("Failed to define schema: %s", err)
+	}
+	return repo
+}
+
+func benchmarkGet(b *testing.B, options *RepositoryOptions, key Key) {
+	repo := setUpBenchRepo(b, options)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := repo.Get(key); !ok {
+			b.Fatalf("Failed to get key %q", key)
+		}
+	}
+}
+
+func BenchmarkGet_Leaf(b *testing.B) {
+	benchmarkGet(b, &RepositoryOptions{}, NewKey("components.comp1.param1"))
+}
+
+func BenchmarkGet_LeafCached(b *testing.B) {
+	benchmarkGet(b, &RepositoryOptions{Cache: true}, NewKey("components.comp1.param1"))
+}
+
+func BenchmarkGet_Intermediate(b *testing.B) {
+	benchmarkGet(b, &RepositoryOptions{}, NewKey("components"))
+}
+
+func BenchmarkGet_IntermediateCached(b *testing.B) {
+	benchmarkGet(b, &RepositoryOptions{Cache: true}, NewKey("components"))
+}
+
+// lateTestProv registers a key in SetUp and gets ready once SetUp is done,
+// the way the built-in providers do.
+type lateTestProv struct {
+	*TestProv
+	ready chan struct{}
+}
+
+func (ltp *lateTestProv) Name() string { return "late" }
+
+func (ltp *lateTestProv) SetUp(repo *Repository) error {
+	defer close(ltp.ready)
+	repo.RegisterKey(NewKey("foo"), ltp)
+	// A concurrent lookup while the provider is not ready yet
+	if _, ok := repo.Get(NewKey("foo")); ok {
+		return fmt.Errorf("expected no value from a provider which is not ready")
+	}
+	return nil
+}
+
+func (ltp *lateTestProv) Get(key Key) (*KeyValue, bool) {
+	if !isReady(ltp.ready) {
+		return nil, false
+	}
+	return ltp.TestProv.Get(key)
+}
+
+func TestCacheProviderSetUp(t *testing.T) {
+	repo := NewRepositoryWithOptions(&RepositoryOptions{Cache: true})
+	repo.RegisterProvider(&lateTestProv{TestProv: NewTestProv("bar", 10), ready: make(chan struct{})})
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+	if got, ok := repo.Get(NewKey("foo")); !ok || got != "bar" {
+		t.Fatalf("Unexpected value after the provider set up: got: %#v, %t", got, ok)
+	}
+}
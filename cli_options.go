@@ -0,0 +1,270 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	longOptPrefix    = "--"
+	negatedOptPrefix = "no-"
+	maxSuggestions   = 3
+)
+
+// longOption is a GNU-style long option which is not a registered flag.
+type longOption struct {
+	name     string
+	value    string
+	hasValue bool
+}
+
+// splitLongOptions extracts GNU-style long options from the arguments.
+// Options matching a flag registered in the flag set (and the help flags) are
+// left for the flag set to parse along with their values. A value of a long
+// option is either attached with `=` or taken from the next argument if it
+// does not start with a dash and the option does not stand for a bool schema
+// key (mappers might be nil). The extraction stops at the first non-flag
+// argument the same way the flag set parsing does: it and everything after it
+// (as well as everything after `--`) is left intact.
+func splitLongOptions(fs *flag.FlagSet, mappers *MapperNode, args []string) ([]string, []longOption) {
+	rest := make([]string, 0, len(args))
+	opts := make([]longOption, 0)
+	for ix := 0; ix < len(args); ix++ {
+		arg := args[ix]
+		if arg == longOptPrefix || len(arg) < 2 || arg[0] != '-' {
+			rest = append(rest, args[ix:]...)
+			break
+		}
+		name := strings.TrimPrefix(arg[1:], "-")
+		attached := false
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, attached = name[:eq], true
+		}
+		if f := fs.Lookup(name); f != nil || name == "h" || name == "help" {
+			rest = append(rest, arg)
+			if f != nil && !attached && !isBoolFlag(f.Value) && ix+1 < len(args) {
+				ix++
+				rest = append(rest, args[ix])
+			}
+			continue
+		}
+		if !strings.HasPrefix(arg, longOptPrefix) {
+			// An unknown short flag is reported by the flag set
+			rest = append(rest, arg)
+			continue
+		}
+		opt := longOption{name: arg[len(longOptPrefix):]}
+		if eq := strings.Index(opt.name, "="); eq >= 0 {
+			opt.name, opt.value, opt.hasValue = opt.name[:eq], opt.name[eq+1:], true
+		}
+		if !opt.hasValue && ix+1 < len(args) && !strings.HasPrefix(args[ix+1], "-") && !isBoolOption(mappers, opt) {
+			opt.value, opt.hasValue = args[ix+1], true
+			ix++
+		}
+		opts = append(opts, opt)
+	}
+	return rest, opts
+}
+
+// isBoolOption returns true if the option without a value stands for a bool
+// schema key: either the key mapper produces bools or the option is a negated
+// one (`--no-foo`).
+func isBoolOption(mappers *MapperNode, opt longOption) bool {
+	if mappers == nil || len(mappers.Children) == 0 {
+		return false
+	}
+	key, value, err := resolveLongOption(mappers, opt)
+	if err != nil {
+		return false
+	}
+	if value == false {
+		return true
+	}
+	ptr := mappers.Find(NewKey(key))
+	return ptr != nil && typeName(ptr.Mpr) == "bool"
+}
+
+// isBoolFlag returns true if the flag does not take a value (see
+// flag.Value).
+func isBoolFlag(v flag.Value) bool {
+	bf, ok := v.(interface{ IsBoolFlag() bool })
+	return ok && bf.IsBoolFlag()
+}
+
+// optionAttempt is a possible interpretation of a long option.
+type optionAttempt struct {
+	name  string
+	value Value
+}
+
+// attempts returns the possible interpretations of the option, the most
+// literal first: `--no-foo` is either a `no-foo` key set to true or a `foo`
+// key set to false.
+func (opt longOption) attempts() []optionAttempt {
+	var value Value = true
+	if opt.hasValue {
+		value = opt.value
+	}
+	res := []optionAttempt{{name: opt.name, value: value}}
+	if !opt.hasValue && strings.HasPrefix(opt.name, negatedOptPrefix) {
+		res = append(res, optionAttempt{name: opt.name[len(negatedOptPrefix):], value: false})
+	}
+	return res
+}
+
+// keyCandidates returns the config keys an option name might stand for: the
+// name itself and the name with dashes interpreted as key separators or
+// underscores.
+func keyCandidates(name string) []string {
+	res := []string{name}
+	if strings.Contains(name, "-") {
+		res = append(res,
+			strings.Replace(name, "-", KeySepCh, -1),
+			strings.Replace(name, "-", "_", -1),
+		)
+	}
+	return res
+}
+
+// resolveLongOption maps the option to a config key. If the schema is
+// empty, any option is accepted: dashes are interpreted as key separators
+// unless the name contains a separator already. Otherwise the option must
+// match a key known to the schema.
+func resolveLongOption(mappers *MapperNode, opt longOption) (string, Value, error) {
+	attempts := opt.attempts()
+	if len(mappers.Children) == 0 {
+		a := attempts[len(attempts)-1]
+		key := a.name
+		if !strings.Contains(key, KeySepCh) {
+			key = strings.Replace(key, "-", KeySepCh, -1)
+		}
+		return key, a.value, nil
+	}
+	for _, a := range attempts {
+		for _, cand := range keyCandidates(a.name) {
+			if schemaKnows(mappers, NewKey(cand)) {
+				return cand, a.value, nil
+			}
+		}
+	}
+	return "", nil, unknownOptionError(mappers, opt)
+}
+
+// schemaKnows returns true if the key is declared in the schema or it is a
+// sub-key of a schema leaf.
+func schemaKnows(mappers *MapperNode, key Key) bool {
+	for ix := len(key); ix > 0; ix-- {
+		if ptr := mappers.Find(key[:ix]); ptr != nil {
+			return ix == len(key) || len(ptr.Children) == 0
+		}
+	}
+	return false
+}
+
+func unknownOptionError(mappers *MapperNode, opt longOption) error {
+	name, prefix := opt.name, longOptPrefix
+	if !opt.hasValue && strings.HasPrefix(name, negatedOptPrefix) {
+		name, prefix = name[len(negatedOptPrefix):], longOptPrefix+negatedOptPrefix
+	}
+	suggestions := suggestKeys(mappers.Keys(), strings.Replace(name, "-", KeySepCh, -1))
+	if len(suggestions) == 0 {
+		return fmt.Errorf("unknown option %q", longOptPrefix+opt.name)
+	}
+	quoted := make([]string, 0, len(suggestions))
+	for _, s := range suggestions {
+		quoted = append(quoted, fmt.Sprintf("%q", prefix+s))
+	}
+	return fmt.Errorf("unknown option %q, did you mean %s?", longOptPrefix+opt.name, strings.Join(quoted, " or "))
+}
+
+// suggestKeys returns up to maxSuggestions keys closest to the name by the
+// edit distance. Wildcard keys are never suggested.
+func suggestKeys(keys []Key, name string) []string {
+	type scored struct {
+		key  string
+		dist int
+	}
+	threshold := len(name) / 3
+	if threshold < 2 {
+		threshold = 2
+	}
+	candidates := make([]scored, 0)
+	for _, k := range keys {
+		ks := k.String()
+		if strings.Contains(ks, "*") {
+			continue
+		}
+		if d := levenshtein(name, ks); d <= threshold {
+			candidates = append(candidates, scored{key: ks, dist: d})
+		}
+	}
+	sort.Slice(candidates, func(a, b int) bool {
+		if candidates[a].dist != candidates[b].dist {
+			return candidates[a].dist < candidates[b].dist
+		}
+		return candidates[a].key < candidates[b].key
+	})
+	res := make([]string, 0, maxSuggestions)
+	for ix := 0; ix < len(candidates) && ix < maxSuggestions; ix++ {
+		res = append(res, candidates[ix].key)
+	}
+	return res
+}
+
+// levenshtein returns the edit distance between 2 strings.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// applyLongOptions resolves the long options against the schema and stores
+// the values in the registry. All unknown options are reported at once.
+func (cp *CliProvider) applyLongOptions(mappers *MapperNode) error {
+	errs := make([]error, 0)
+	for _, opt := range cp.longOpts {
+		appendOp := false
+		if opt.hasValue && strings.HasSuffix(opt.name, "+") {
+			opt.name, appendOp = opt.name[:len(opt.name)-1], true
+		}
+		key, value, err := resolveLongOption(mappers, opt)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if s, ok := value.(string); ok && opt.hasValue {
+			cp.store(key, s, appendOp)
+			continue
+		}
+		cp.registry[key] = value
+		cp.raw.forget(key)
+	}
+	return combineErrors(errs)
+}
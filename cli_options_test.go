@@ -0,0 +1,215 @@
+package config
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestSplitLongOptions(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Bool("verbose", false, "")
+	fs.String("o", "", "")
+	args := []string{
+		"--foo.bar=1", "--verbose", "--foo.baz", "2", "-o", "a=b",
+		"--no-foo.enabled", "--foo-moo", "--", "--pos",
+	}
+	gotRest, gotOpts := splitLongOptions(fs, nil, args)
+	wantRest := []string{"--verbose", "-o", "a=b", "--", "--pos"}
+	wantOpts := []longOption{
+		{name: "foo.bar", value: "1", hasValue: true},
+		{name: "foo.baz", value: "2", hasValue: true},
+		{name: "no-foo.enabled"},
+		{name: "foo-moo"},
+	}
+	if !reflect.DeepEqual(gotRest, wantRest) {
+		t.Fatalf("Unexpected rest args: got: %#v, want: %#v", gotRest, wantRest)
+	}
+	if !reflect.DeepEqual(gotOpts, wantOpts) {
+		t.Fatalf("Unexpected long options: got: %#v, want: %#v", gotOpts, wantOpts)
+	}
+}
+
+func TestCliProviderLongOptions(t *testing.T) {
+	schema := map[string]Schema{
+		"system": map[string]Schema{
+			"maxprocs": ToInt,
+			"admin": map[string]Schema{
+				"enabled": ToBool,
+			},
+		},
+		"log_level": ToStr,
+		"plugins": map[string]Schema{
+			"*": map[string]Schema{
+				"path": ToStr,
+			},
+		},
+	}
+	tests := []struct {
+		name         string
+		schema       Schema
+		args         []string
+		wantRegistry map[string]Value
+		wantErr      string
+	}{
+		{
+			"No schema",
+			nil,
+			[]string{"--foo.bar=1", "--foo.baz", "2", "--no-foo.enabled", "--foo-moo", "--flag"},
+			map[string]Value{"foo.bar": "1", "foo.baz": "2", "foo.enabled": false, "foo.moo": true, "flag": true},
+			"",
+		},
+		{
+			"Schema keys",
+			schema,
+			[]string{
+				"--system.maxprocs", "4", "--no-system.admin.enabled",
+				"--log-level=debug", "--plugins.tcp.path=/tmp",
+			},
+			map[string]Value{
+				"system.maxprocs":      "4",
+				"system.admin.enabled": false,
+				"log_level":            "debug",
+				"plugins.tcp.path":     "/tmp",
+			},
+			"",
+		},
+		{
+			"Dashed keys",
+			schema,
+			[]string{"--system-maxprocs=4", "--system-admin-enabled"},
+			map[string]Value{"system.maxprocs": "4", "system.admin.enabled": true},
+			"",
+		},
+		{
+			"Unknown options",
+			schema,
+			[]string{"--system.maxproc=4", "--no-system.admin.enable", "--totally.unknown"},
+			map[string]Value{},
+			`unknown option "--system.maxproc", did you mean "--system.maxprocs"?; ` +
+				`unknown option "--no-system.admin.enable", did you mean "--no-system.admin.enabled"?; ` +
+				`unknown option "--totally.unknown"`,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := NewRepository()
+			if testCase.schema != nil {
+				if err := repo.DefineSchema(testCase.schema); err != nil {
+					t.Fatalf("Failed to define the schema: %s", err)
+				}
+			}
+			prov, err := NewCliProviderWithOptions(repo, 0, &CliProviderOptions{Args: testCase.args})
+			if err != nil {
+				t.Fatalf("Failed to initialize a new cli provider: %s", err)
+			}
+			err = prov.SetUp(repo)
+			if len(testCase.wantErr) > 0 {
+				if err == nil || err.Error() != testCase.wantErr {
+					t.Fatalf("Unexpected error: got: %v, want: %s", err, testCase.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to set up cli provider: %s", err)
+			}
+			if !reflect.DeepEqual(prov.registry, testCase.wantRegistry) {
+				t.Fatalf("Unexpected registry: got: %#v, want: %#v", prov.registry, testCase.wantRegistry)
+			}
+		})
+	}
+}
+
+func TestCliProviderPositionalArgs(t *testing.T) {
+	schema := map[string]Schema{
+		"system": map[string]Schema{
+			"maxprocs": ToInt,
+		},
+		"verbose": ToBool,
+	}
+	tests := []struct {
+		name         string
+		schema       Schema
+		args         []string
+		wantRegistry map[string]Value
+		wantArgs     []string
+	}{
+		{
+			"Schema",
+			schema,
+			[]string{"-o", "system.maxprocs=2", "run", "--force", "target"},
+			map[string]Value{"system.maxprocs": "2"},
+			[]string{"run", "--force", "target"},
+		},
+		{
+			"Bool schema key",
+			schema,
+			[]string{"--verbose", "input.txt"},
+			map[string]Value{"verbose": true},
+			[]string{"input.txt"},
+		},
+		{
+			"Negated bool schema key",
+			schema,
+			[]string{"--no-verbose", "input.txt"},
+			map[string]Value{"verbose": false},
+			[]string{"input.txt"},
+		},
+		{
+			"No schema",
+			nil,
+			[]string{"--log.level=debug", "run", "--force", "target"},
+			map[string]Value{"log.level": "debug"},
+			[]string{"run", "--force", "target"},
+		},
+		{
+			"Stdin",
+			nil,
+			[]string{"-", "--force"},
+			map[string]Value{},
+			[]string{"-", "--force"},
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := NewRepository()
+			if testCase.schema != nil {
+				if err := repo.DefineSchema(testCase.schema); err != nil {
+					t.Fatalf("Failed to define the schema: %s", err)
+				}
+			}
+			prov, err := NewCliProviderWithOptions(repo, 0, &CliProviderOptions{Args: testCase.args})
+			if err != nil {
+				t.Fatalf("Failed to initialize a new cli provider: %s", err)
+			}
+			if err := prov.SetUp(repo); err != nil {
+				t.Fatalf("Failed to set up cli provider: %s", err)
+			}
+			if !reflect.DeepEqual(prov.registry, testCase.wantRegistry) {
+				t.Fatalf("Unexpected registry: got: %#v, want: %#v", prov.registry, testCase.wantRegistry)
+			}
+			if got := prov.Args(); !reflect.DeepEqual(got, testCase.wantArgs) {
+				t.Fatalf("Unexpected positional args: got: %#v, want: %#v", got, testCase.wantArgs)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"system.maxproc", "system.maxprocs", 1},
+	}
+	for _, testCase := range tests {
+		if got := levenshtein(testCase.a, testCase.b); got != testCase.want {
+			t.Fatalf("Unexpected distance between %q and %q: got: %d, want: %d", testCase.a, testCase.b, got, testCase.want)
+		}
+	}
+}
@@ -1,47 +1,113 @@
 package config
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"os"
 	"strings"
 )
 
 // Redefined in tests
-var regFlags = func(cp *CliProvider) {
-	if !flag.Parsed() {
-		flag.Var(cp, "o", "Extra options")
-		flag.Parse()
+var regFlags = func(cp *CliProvider) error {
+	if cp.flagSet.Parsed() {
+		return nil
 	}
+	if cp.flagSet.Lookup("o") == nil {
+		cp.flagSet.Var(cp, "o", "Extra options")
+	}
+	cp.wrapUsage()
+	args, longOpts := splitLongOptions(cp.flagSet, cp.repo.loadMappers(), cp.args)
+	cp.longOpts = longOpts
+	return cp.flagSet.Parse(args)
 }
 
 // CliProvider serves command-line flag values. By default, it registers a few
 // basic flags, backing a full range of config keys by -o attribute.
 type CliProvider struct {
+	name     string
+	repo     *Repository
 	weight   int
 	registry map[string]Value
 	ready    chan struct{}
+	state    healthState
+	flagSet  *flag.FlagSet
+	args     []string
+	longOpts []longOption
+	raw      rawRegistry
+}
+
+// CliProviderOptions is a set of optional CliProvider settings.
+type CliProviderOptions struct {
+	// Instance is the provider instance name: the provider is named
+	// cli:<Instance> (see ProviderName).
+	Instance string
+	// FlagSet is the flag set the -o flag is registered in and the arguments
+	// are parsed with. If nil, a private flag set is used if Args are
+	// defined and flag.CommandLine otherwise. An already parsed flag set is
+	// not parsed again: in this case the -o flag is expected to be
+	// registered by the caller (CliProvider implements flag.Value).
+	FlagSet *flag.FlagSet
+	// Args are the command line arguments to parse, without the program
+	// name. If nil, os.Args[1:] are used.
+	Args []string
+	// InferTypes enables the value type inference (see InferValue). The
+	// original input is available via Raw.
+	InferTypes bool
 }
 
 var _ Provider = (*CliProvider)(nil)
+var _ ContextGetProvider = (*CliProvider)(nil)
+var _ HealthProvider = (*CliProvider)(nil)
+var _ RawProvider = (*CliProvider)(nil)
 var _ flag.Value = (*CliProvider)(nil)
 
-// NewCliProvider returns a new instance of CliProvider.
+// NewCliProvider returns a new instance of CliProvider. The -o flag is
+// registered in flag.CommandLine and os.Args are parsed on SetUp unless
+// flag.CommandLine has already been parsed.
 func NewCliProvider(repo *Repository, weight int) (*CliProvider, error) {
+	return NewCliProviderWithOptions(repo, weight, &CliProviderOptions{})
+}
+
+// NewCliProviderWithOptions returns a new instance of CliProvider configured
+// according to the options. Unlike the default configuration, explicitly
+// defined arguments are parsed with a private flag set, leaving
+// flag.CommandLine intact.
+func NewCliProviderWithOptions(repo *Repository, weight int, options *CliProviderOptions) (*CliProvider, error) {
+	flagSet, args := options.FlagSet, options.Args
+	if args == nil {
+		args = os.Args[1:]
+	}
+	if flagSet == nil {
+		if options.Args != nil {
+			flagSet = flag.NewFlagSet("config", flag.ContinueOnError)
+		} else {
+			flagSet = flag.CommandLine
+		}
+	}
 	prov := &CliProvider{
+		name:     ProviderName("cli", options.Instance),
+		repo:     repo,
 		weight:   weight,
 		registry: make(map[string]Value),
 		ready:    make(chan struct{}),
+		flagSet:  flagSet,
+		args:     args,
+		raw:      newRawRegistry(options.InferTypes),
+	}
+	if err := repo.RegisterNewProvider(prov); err != nil {
+		return nil, err
 	}
-	repo.RegisterProvider(prov)
 
 	return prov, nil
 }
 
-// Name returns provider name: cli
-func (cp *CliProvider) Name() string { return "cli" }
+// Name returns provider name: cli or cli:<instance>
+func (cp *CliProvider) Name() string { return cp.name }
 
-// Depends returns the list of provider dependencies: default
-func (cp *CliProvider) Depends() []string { return []string{"default"} }
+// Depends returns the list of provider dependencies: default (soft).
+// The defaults are optional: the provider serves its own values regardless.
+func (cp *CliProvider) Depends() []string { return []string{SoftDependency("default")} }
 
 //Weight returns the provider weight
 func (cp *CliProvider) Weight() int { return cp.weight }
@@ -49,26 +115,65 @@ func (cp *CliProvider) Weight() int { return cp.weight }
 // String satisfies flag.Value() interface
 func (cp *CliProvider) String() string { return fmt.Sprintf("%v", cp.registry) }
 
-// Set satisfies flag.Value() interface
+// Set satisfies flag.Value() interface. The value is split on the first `=`
+// sign: the value part might contain `=` signs itself. A repeated key
+// collects the values into a list, so does `key+=value` syntax even for a
+// single occurrence.
 func (cp *CliProvider) Set(val string) error {
-	if chunks := strings.Split(val, "="); len(chunks) > 2 {
-		return fmt.Errorf("Possibly malformed flag (way too many `=`): %q", val)
-	} else if len(chunks) == 2 {
-		cp.registry[chunks[0]] = chunks[1]
-	} else {
+	eq := strings.Index(val, "=")
+	if eq < 0 {
 		cp.registry[val] = true
+		cp.raw.forget(val)
+		return nil
+	}
+	key, value, appendOp := val[:eq], val[eq+1:], false
+	if strings.HasSuffix(key, "+") {
+		key, appendOp = key[:len(key)-1], true
 	}
+	if len(key) == 0 {
+		return fmt.Errorf("Possibly malformed flag (empty key): %q", val)
+	}
+	cp.store(key, value, appendOp)
 	return nil
 }
 
+// store puts the value in the registry. If the key is already defined or
+// appendOp is set, the value is appended to the list of the key values.
+func (cp *CliProvider) store(key string, value string, appendOp bool) {
+	prev, exists := cp.registry[key]
+	if !exists && !appendOp {
+		cp.registry[key] = cp.raw.parse(key, value)
+		return
+	}
+	list, ok := prev.([]Value)
+	if !ok {
+		list = make([]Value, 0, 2)
+		if exists {
+			list = append(list, prev)
+		}
+	}
+	cp.registry[key] = append(list, cp.raw.parseItem(key, value, !exists))
+}
+
 // SetUp registers a bunch of command line flags (if not registered).
 // Flag list:
 // * -config.path: the config file location
 // * -plugins.path: the plugin folder location
 // * -o: extra options, ex: -o system.maxproc=4 -o pipeline.tcp_rcv.connect=udp
-func (cp *CliProvider) SetUp(repo *Repository) error {
+// GNU-style long options are accepted as well: --system.maxproc=4,
+// --system.maxproc 4, --system-maxproc=4 and --no-system.admin.enabled (sets
+// the key to false). If the repository schema is defined, a long option must
+// match a schema key: unknown options fail the set up with suggestions.
+// The -h usage screen lists the schema keys (see WriteUsage).
+func (cp *CliProvider) SetUp(repo *Repository) (err error) {
 	defer close(cp.ready)
-	regFlags(cp)
+	defer func() { cp.state.loaded(err) }()
+	if err := regFlags(cp); err != nil {
+		return fmt.Errorf("failed to parse command line arguments: %w", err)
+	}
+	if err := cp.applyLongOptions(repo.loadMappers()); err != nil {
+		return err
+	}
 	for k := range cp.registry {
 		if err := repo.RegisterKey(NewKey(k), cp); err != nil {
 			return err
@@ -77,14 +182,49 @@ func (cp *CliProvider) SetUp(repo *Repository) error {
 	return nil
 }
 
-// TearDown is a no-op operation for CliProvider
-func (cp *CliProvider) TearDown(*Repository) error { return nil }
+// Args returns the positional arguments left after the flags have been
+// parsed.
+func (cp *CliProvider) Args() []string {
+	return cp.flagSet.Args()
+}
+
+// TearDown resets the provider health: the provider is not ready anymore.
+func (cp *CliProvider) TearDown(*Repository) error {
+	cp.state.reset()
+	return nil
+}
 
-// Get is the primary method for fetching values from the cli registry
+// Get is the primary method for fetching values from the cli registry.
+// Never blocks: returns nothing until the provider is set up.
 func (cp *CliProvider) Get(key Key) (*KeyValue, bool) {
-	<-cp.ready
+	if !isReady(cp.ready) {
+		return nil, false
+	}
+	return cp.GetContext(context.Background(), key)
+}
+
+// GetContext is the same as Get, but waits for the provider to get ready
+// until the context is done. A context which is never done does not wait.
+func (cp *CliProvider) GetContext(ctx context.Context, key Key) (*KeyValue, bool) {
+	if !waitReady(ctx, cp.ready) {
+		return nil, false
+	}
 	if v, ok := cp.registry[key.String()]; ok {
 		return &KeyValue{Key: key, Value: v}, ok
 	}
 	return nil, false
 }
+
+// Raw returns the original input for the key if the value type has been
+// inferred.
+func (cp *CliProvider) Raw(key Key) (string, bool) {
+	if !isReady(cp.ready) {
+		return "", false
+	}
+	return cp.raw.get(key)
+}
+
+// Health returns the provider health report.
+func (cp *CliProvider) Health() ProviderHealth {
+	return cp.state.health(cp.ready)
+}
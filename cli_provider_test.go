@@ -1,7 +1,9 @@
 package config
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"reflect"
 	"sort"
 	"strings"
@@ -37,10 +39,11 @@ func TestCliProviderSetUp(t *testing.T) {
 
 			// Redefined function
 			oldRegFlags := regFlags
-			regFlags = func(cp *CliProvider) {
+			regFlags = func(cp *CliProvider) error {
 				for k, v := range testCase.registry {
 					cp.registry[k] = v
 				}
+				return nil
 			}
 
 			repo := NewRepository()
@@ -97,10 +100,22 @@ func TestCliProviderSet(t *testing.T) {
 			nil,
 		},
 		{
-			"Way too many = signs",
-			"foo=bar=baz",
+			"A value with = signs",
+			"dsn=user=x;password=y==",
+			map[string]Value{"dsn": "user=x;password=y=="},
+			nil,
+		},
+		{
+			"An explicit append",
+			"peers+=a",
+			map[string]Value{"peers": []Value{"a"}},
+			nil,
+		},
+		{
+			"An empty key",
+			"=bar",
 			map[string]Value{},
-			fmt.Errorf("Possibly malformed flag (way too many `=`): %q", "foo=bar=baz"),
+			fmt.Errorf("Possibly malformed flag (empty key): %q", "=bar"),
 		},
 	}
 
@@ -123,3 +138,85 @@ func TestCliProviderSet(t *testing.T) {
 		})
 	}
 }
+
+func TestCliProviderWithOptions(t *testing.T) {
+	customFlagSet := func() *flag.FlagSet {
+		fs := flag.NewFlagSet("app", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		fs.Bool("verbose", false, "Verbose output")
+		return fs
+	}
+	tests := []struct {
+		name         string
+		options      *CliProviderOptions
+		wantRegistry map[string]Value
+		wantArgs     []string
+		wantErr      bool
+	}{
+		{
+			"Private flag set",
+			&CliProviderOptions{Args: []string{"-o", "foo.bar=1", "-o", "baz", "run", "fast"}},
+			map[string]Value{"foo.bar": "1", "baz": true},
+			[]string{"run", "fast"},
+			false,
+		},
+		{
+			"Custom flag set",
+			&CliProviderOptions{
+				FlagSet: customFlagSet(),
+				Args:    []string{"-verbose", "-o", "foo=bar", "--", "-o"},
+			},
+			map[string]Value{"foo": "bar"},
+			[]string{"-o"},
+			false,
+		},
+		{
+			"Repeated keys",
+			&CliProviderOptions{Args: []string{
+				"-o", "peers=a", "-o", "peers=b", "-o", "peers+=c", "--peers=d",
+				"--tags+=x", "-o", "dsn=user=x",
+			}},
+			map[string]Value{
+				"peers": []Value{"a", "b", "c", "d"},
+				"tags":  []Value{"x"},
+				"dsn":   "user=x",
+			},
+			[]string{},
+			false,
+		},
+		{
+			"Unknown flag",
+			&CliProviderOptions{
+				FlagSet: customFlagSet(),
+				Args:    []string{"-quiet"},
+			},
+			map[string]Value{},
+			[]string{},
+			true,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := NewRepository()
+			prov, err := NewCliProviderWithOptions(repo, 0, testCase.options)
+			if err != nil {
+				t.Fatalf("Failed to initialize a new cli provider: %s", err)
+			}
+			err = prov.SetUp(repo)
+			if (err != nil) != testCase.wantErr {
+				t.Fatalf("Unexpected set up error: %v, want error: %t", err, testCase.wantErr)
+			}
+			if !reflect.DeepEqual(prov.registry, testCase.wantRegistry) {
+				t.Fatalf("Unexpected registry: got: %#v, want: %#v", prov.registry, testCase.wantRegistry)
+			}
+			if err == nil && !reflect.DeepEqual(prov.Args(), testCase.wantArgs) {
+				t.Fatalf("Unexpected positional args: got: %#v, want: %#v", prov.Args(), testCase.wantArgs)
+			}
+		})
+	}
+
+	if flag.CommandLine.Lookup("o") != nil {
+		t.Fatalf("The global flag set is not expected to be modified")
+	}
+}
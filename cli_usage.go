@@ -0,0 +1,113 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// wrapUsage extends the flag set usage screen with the list of config keys.
+func (cp *CliProvider) wrapUsage() {
+	fs, prev := cp.flagSet, cp.flagSet.Usage
+	if prev == nil {
+		prev = func() {
+			fmt.Fprintf(fs.Output(), "Usage of %s:\n", fs.Name())
+			fs.PrintDefaults()
+		}
+	}
+	fs.Usage = func() {
+		prev()
+		cp.WriteUsage(fs.Output())
+	}
+}
+
+// WriteUsage writes the list of the config keys declared by the repository
+// schema along with their types, descriptions, defaults and the names of the
+// matching environment variables. Secret defaults are redacted. Writes
+// nothing if the schema is empty.
+//
+// Example output:
+//
+//	Config keys:
+//	  --system.maxprocs int
+//	    	Max number of OS threads (default: 4, env: CONFIG_SYSTEM_MAXPROCS)
+func (cp *CliProvider) WriteUsage(w io.Writer) error {
+	mappers := cp.repo.loadMappers()
+	keys := mappers.Keys()
+	if len(keys) == 0 {
+		return nil
+	}
+	defaults, envs := usageProviders(cp.repo)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("Config keys:\n")
+	for _, key := range keys {
+		mn := mappers.Find(key)
+		fmt.Fprintf(buf, "  %s%s", longOptPrefix, key)
+		if mn != nil {
+			if name := typeName(mn.Mpr); len(name) > 0 {
+				fmt.Fprintf(buf, " %s", name)
+			}
+		}
+		details := make([]string, 0, 2)
+		for _, dp := range defaults {
+			if v, ok := dp.registry[key.String()]; ok {
+				if mappers.IsSecret(key) {
+					v = NewSecretValue(v)
+				}
+				details = append(details, fmt.Sprintf("default: %v", v))
+				break
+			}
+		}
+		vars := make([]string, 0, len(envs))
+		for _, ep := range envs {
+			vars = append(vars, ep.VarFor(key))
+		}
+		if len(vars) > 0 {
+			details = append(details, "env: "+strings.Join(vars, ", "))
+		}
+		descr := ""
+		if mn != nil {
+			descr = mn.Descr
+		}
+		if len(details) > 0 {
+			if len(descr) > 0 {
+				descr += " "
+			}
+			descr += "(" + strings.Join(details, ", ") + ")"
+		}
+		if len(descr) > 0 {
+			fmt.Fprintf(buf, "\n    \t%s", strings.Replace(descr, "\n", "\n    \t", -1))
+		}
+		buf.WriteByte('\n')
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// usageProviders returns the registered default and env providers sorted by
+// weight, the heaviest first.
+func usageProviders(repo *Repository) ([]*DefaultProvider, []*EnvProvider) {
+	provs := make([]Provider, 0)
+	for _, prov := range repo.providerMap() {
+		provs = append(provs, prov)
+	}
+	sort.SliceStable(provs, func(a, b int) bool {
+		if provs[a].Weight() != provs[b].Weight() {
+			return provs[a].Weight() > provs[b].Weight()
+		}
+		return provs[a].Name() < provs[b].Name()
+	})
+	defaults, envs := make([]*DefaultProvider, 0), make([]*EnvProvider, 0)
+	for _, prov := range provs {
+		switch p := prov.(type) {
+		case *DefaultProvider:
+			defaults = append(defaults, p)
+		case *EnvProvider:
+			envs = append(envs, p)
+		}
+	}
+	return defaults, envs
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestCliProviderWriteUsage(t *testing.T) {
+	repo := NewRepository()
+	if err := repo.DefineSchema(map[string]Schema{
+		"system": map[string]Schema{
+			"maxprocs": Describe(ToInt, "Max number of OS threads"),
+			"admin": map[string]Schema{
+				"enabled": ToBool,
+			},
+		},
+		"db": map[string]Schema{
+			"password": Secret(Describe(ToStr, "Database password")),
+		},
+	}); err != nil {
+		t.Fatalf("Failed to define the schema: %s", err)
+	}
+	if _, err := NewDefaultProviderWithDefaults(repo, 0, map[string]Value{
+		"system.maxprocs": 4,
+		"db.password":     "secret",
+	}); err != nil {
+		t.Fatalf("Failed to initialize a new default provider: %s", err)
+	}
+	if _, err := NewEnvProviderWithPrefix(repo, 10, "APP_"); err != nil {
+		t.Fatalf("Failed to initialize a new env provider: %s", err)
+	}
+	out := &bytes.Buffer{}
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	fs.SetOutput(out)
+	prov, err := NewCliProviderWithOptions(repo, 20, &CliProviderOptions{FlagSet: fs, Args: []string{"-h"}})
+	if err != nil {
+		t.Fatalf("Failed to initialize a new cli provider: %s", err)
+	}
+
+	want := strings.Join([]string{
+		"Config keys:",
+		"  --db.password string",
+		"    \tDatabase password (default: ******, env: APP_DB_PASSWORD)",
+		"  --system.admin.enabled bool",
+		"    \t(env: APP_SYSTEM_ADMIN_ENABLED)",
+		"  --system.maxprocs int",
+		"    \tMax number of OS threads (default: 4, env: APP_SYSTEM_MAXPROCS)",
+		"",
+	}, "\n")
+	buf := &bytes.Buffer{}
+	if err := prov.WriteUsage(buf); err != nil {
+		t.Fatalf("Failed to write the usage: %s", err)
+	}
+	if got := buf.String(); got != want {
+		t.Fatalf("Unexpected usage:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := prov.SetUp(repo); !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("Unexpected set up error: %v, want: %s", err, flag.ErrHelp)
+	}
+	got := out.String()
+	if !strings.HasPrefix(got, "Usage of app:\n  -o value\n") || !strings.HasSuffix(got, want) {
+		t.Fatalf("Unexpected usage screen:\n%s", got)
+	}
+}
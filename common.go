@@ -24,6 +24,38 @@ func (key Key) Equals(k2 Key) bool {
 	return reflect.DeepEqual(key, k2)
 }
 
+// child returns a new key extended with the fragment. Unlike a bare append,
+// the result never shares the underlying array with the original key.
+func (key Key) child(k string) Key {
+	res := make(Key, len(key), len(key)+1)
+	copy(res, key)
+	return append(res, k)
+}
+
+// hasPrefix returns true if the key starts with all the prefix fragments.
+func (key Key) hasPrefix(prefix Key) bool {
+	if len(prefix) > len(key) {
+		return false
+	}
+	for ix, k := range prefix {
+		if key[ix] != k {
+			return false
+		}
+	}
+	return true
+}
+
+// relatesToAny returns true if the key is equal to, a parent or a sub-key of
+// any of the keys.
+func (key Key) relatesToAny(keys []Key) bool {
+	for _, k := range keys {
+		if key.hasPrefix(k) || k.hasPrefix(key) {
+			return true
+		}
+	}
+	return false
+}
+
 // NewKey is a default constructor used for a new key instantiation.
 // Automatically splits the input string into key fragments.
 func NewKey(str string) Key {
@@ -185,6 +185,54 @@ func (*IfBoolConverter) Convert(kv *KeyValue) (*KeyValue, bool) {
 	return nil, false
 }
 
+//======== Type names =======
+
+// TypeNamer is an optional interface for converters and mappers describing
+// the type of the values they produce, e.g. "int". It is used in the
+// generated usage (see CliProvider.WriteUsage).
+type TypeNamer interface {
+	TypeName() string
+}
+
+// TypeName returns the produced value type name: int
+func (*IntPtrToIntConverter) TypeName() string { return "int" }
+
+// TypeName returns the produced value type name: bool
+func (*BoolPtrToBoolConverter) TypeName() string { return "bool" }
+
+// TypeName returns the produced value type name: string
+func (*StrPtrToStrConverter) TypeName() string { return "string" }
+
+// TypeName returns the produced value type name: bool
+func (*StrToBoolConverter) TypeName() string { return "bool" }
+
+// TypeName returns the produced value type name: int
+func (*StrToIntConverter) TypeName() string { return "int" }
+
+// TypeName returns the produced value type name: bool
+func (*IntToBoolConverter) TypeName() string { return "bool" }
+
+// TypeName returns the produced value type name: string
+func (*IntToStrConverter) TypeName() string { return "string" }
+
+// TypeName returns the produced value type name: int
+func (*IfIntConverter) TypeName() string { return "int" }
+
+// TypeName returns the produced value type name: string
+func (*IfStrConverter) TypeName() string { return "string" }
+
+// TypeName returns the produced value type name: bool
+func (*IfBoolConverter) TypeName() string { return "bool" }
+
+// typeName returns the type name of a converter or a mapper. Empty if
+// unknown.
+func typeName(v interface{}) string {
+	if tn, ok := v.(TypeNamer); ok {
+		return tn.TypeName()
+	}
+	return ""
+}
+
 //======== Composite converters =======
 
 // CompositionStrategy is a family of constants defining the logic of a
@@ -263,6 +311,20 @@ func (cc *CompositeConverter) Convert(kv *KeyValue) (*KeyValue, bool) {
 	return nil, false
 }
 
+// TypeName returns the type name all the chain components agree on. Empty
+// if the components produce different types.
+func (cc *CompositeConverter) TypeName() string {
+	res := ""
+	for _, conv := range cc.converters {
+		name := typeName(conv)
+		if len(name) == 0 || (len(res) > 0 && name != res) {
+			return ""
+		}
+		res = name
+	}
+	return res
+}
+
 var (
 	// Identity is an initialized instance of IdentityConverter
 	Identity *IdentityConverter
@@ -691,3 +691,27 @@ func TestCompositeConverterCompLast(t *testing.T) {
 		})
 	}
 }
+
+func TestConverterTypeName(t *testing.T) {
+	tests := []struct {
+		name string
+		conv Converter
+		want string
+	}{
+		{"ToInt", ToInt, "int"},
+		{"ToStr", ToStr, "string"},
+		{"ToBool", ToBool, "bool"},
+		{"Identity", Identity, ""},
+		{"Mixed chain", NewCompositeConverter(CompOr, IfInt, IfStr), ""},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := typeName(testCase.conv); got != testCase.want {
+				t.Fatalf("Unexpected type name: got: %q, want: %q", got, testCase.want)
+			}
+			if got := typeName(NewConvMapper(testCase.conv)); got != testCase.want {
+				t.Fatalf("Unexpected mapper type name: got: %q, want: %q", got, testCase.want)
+			}
+		})
+	}
+}
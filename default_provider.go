@@ -1,16 +1,24 @@
 package config
 
+import (
+	"context"
+)
+
 // DefaultProvider represents a set of default values.
 // Prefer keeping defaults over providing default values local to other
 // providers as it guarantees presence of the default values indiffirent to
 // the provider set that have been activated.
 type DefaultProvider struct {
+	name     string
 	weight   int
 	registry map[string]Value
 	ready    chan struct{}
+	state    healthState
 }
 
 var _ Provider = (*DefaultProvider)(nil)
+var _ ContextGetProvider = (*DefaultProvider)(nil)
+var _ HealthProvider = (*DefaultProvider)(nil)
 
 // NewDefaultProvider is a constructor for DefaultProvider.
 func NewDefaultProvider(repo *Repository, weight int) (*DefaultProvider, error) {
@@ -21,17 +29,39 @@ func NewDefaultProvider(repo *Repository, weight int) (*DefaultProvider, error)
 // DefaultProvider. Accepts an extra registry argument as a complete replacement
 // for the default one.
 func NewDefaultProviderWithDefaults(repo *Repository, weight int, registry map[string]Value) (*DefaultProvider, error) {
+	return NewDefaultProviderWithOptions(repo, weight, &DefaultProviderOptions{Defaults: registry})
+}
+
+// DefaultProviderOptions is a set of optional DefaultProvider settings.
+type DefaultProviderOptions struct {
+	// Instance is the provider instance name: the provider is named
+	// default:<Instance> (see ProviderName).
+	Instance string
+	// Defaults is the default value registry: key -> value.
+	Defaults map[string]Value
+}
+
+// NewDefaultProviderWithOptions returns a new instance of DefaultProvider
+// configured according to the options.
+func NewDefaultProviderWithOptions(repo *Repository, weight int, options *DefaultProviderOptions) (*DefaultProvider, error) {
+	registry := options.Defaults
+	if registry == nil {
+		registry = map[string]Value{}
+	}
 	prov := &DefaultProvider{
+		name:     ProviderName("default", options.Instance),
 		weight:   weight,
 		registry: registry,
 		ready:    make(chan struct{}),
 	}
-	repo.RegisterProvider(prov)
+	if err := repo.RegisterNewProvider(prov); err != nil {
+		return nil, err
+	}
 	return prov, nil
 }
 
-// Name returns provider name: default
-func (dp *DefaultProvider) Name() string { return "default" }
+// Name returns provider name: default or default:<instance>
+func (dp *DefaultProvider) Name() string { return dp.name }
 
 // Depends returns the list of provider dependencies: none
 func (dp *DefaultProvider) Depends() []string { return []string{} }
@@ -40,8 +70,9 @@ func (dp *DefaultProvider) Depends() []string { return []string{} }
 func (dp *DefaultProvider) Weight() int { return dp.weight }
 
 // SetUp registers all keys from the registry in the repo
-func (dp *DefaultProvider) SetUp(repo *Repository) error {
+func (dp *DefaultProvider) SetUp(repo *Repository) (err error) {
 	defer close(dp.ready)
+	defer func() { dp.state.loaded(err) }()
 	for k := range dp.registry {
 		if err := repo.RegisterKey(NewKey(k), dp); err != nil {
 			return err
@@ -50,14 +81,34 @@ func (dp *DefaultProvider) SetUp(repo *Repository) error {
 	return nil
 }
 
-// TearDown is a no-op operation for DefaultProvider
-func (dp *DefaultProvider) TearDown(*Repository) error { return nil }
+// TearDown resets the provider health: the provider is not ready anymore.
+func (dp *DefaultProvider) TearDown(*Repository) error {
+	dp.state.reset()
+	return nil
+}
 
-// Get is the primary method for fetching values from the default registry
+// Get is the primary method for fetching values from the default registry.
+// Never blocks: returns nothing until the provider is set up.
 func (dp *DefaultProvider) Get(key Key) (*KeyValue, bool) {
-	<-dp.ready
+	if !isReady(dp.ready) {
+		return nil, false
+	}
+	return dp.GetContext(context.Background(), key)
+}
+
+// GetContext is the same as Get, but waits for the provider to get ready
+// until the context is done. A context which is never done does not wait.
+func (dp *DefaultProvider) GetContext(ctx context.Context, key Key) (*KeyValue, bool) {
+	if !waitReady(ctx, dp.ready) {
+		return nil, false
+	}
 	if val, ok := dp.registry[key.String()]; ok {
 		return &KeyValue{Key: key, Value: val}, ok
 	}
 	return nil, false
 }
+
+// Health returns the provider health report.
+func (dp *DefaultProvider) Health() ProviderHealth {
+	return dp.state.health(dp.ready)
+}
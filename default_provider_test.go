@@ -1,10 +1,12 @@
 package config
 
 import (
+	"context"
 	"reflect"
 	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultProviderSetUp(t *testing.T) {
@@ -62,3 +64,25 @@ func TestDefaultProviderSetUp(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultProviderGetContext(t *testing.T) {
+	repo := NewRepository()
+	prov, err := NewDefaultProviderWithDefaults(repo, 0, map[string]Value{"foo": 42})
+	if err != nil {
+		t.Fatalf("failed to initialize a new default provider: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if kv, ok := prov.GetContext(ctx, NewKey("foo")); ok {
+		t.Fatalf("expected the provider to give up before set up, got: %#v", kv)
+	}
+
+	if err := prov.SetUp(repo); err != nil {
+		t.Fatalf("failed to set up default provider: %s", err)
+	}
+	kv, ok := prov.GetContext(ctx, NewKey("foo"))
+	if !ok || kv.Value != 42 {
+		t.Fatalf("unexpected lookup result: %#v, %t", kv, ok)
+	}
+}
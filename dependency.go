@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SoftDepPrefix is a prefix marking a provider dependency as soft (optional).
+const SoftDepPrefix = "?"
+
+// InstanceSep separates the provider type and the instance name in a
+// provider name, e.g. env:APP_.
+const InstanceSep = ":"
+
+// ProviderName returns the name of a provider instance: <type>:<instance>.
+// Returns the type as is if the instance is empty.
+func ProviderName(typ, instance string) string {
+	if len(instance) == 0 {
+		return typ
+	}
+	return typ + InstanceSep + instance
+}
+
+// ProviderType returns the type part of a provider name: env for env:APP_.
+func ProviderType(name string) string {
+	if ix := strings.Index(name, InstanceSep); ix != -1 {
+		return name[:ix]
+	}
+	return name
+}
+
+// satisfiesDependency returns true if the provider name matches the
+// dependency: either the exact instance name or the provider type.
+func satisfiesDependency(name, dep string) bool {
+	return name == dep || (!strings.Contains(dep, InstanceSep) && ProviderType(name) == dep)
+}
+
+// SoftDependency marks the provider name as a soft dependency. A soft
+// dependency only affects the initialization order if the provider it
+// refers to is registered: a missing soft dependency is not an error.
+// A dependency might refer to a provider type (e.g. env: all the env
+// provider instances) or to a specific instance (e.g. env:APP_).
+//
+// Example:
+//
+//	func (p *MyProvider) Depends() []string {
+//		return []string{"env", SoftDependency("cli")}
+//	}
+func SoftDependency(name string) string {
+	return SoftDepPrefix + name
+}
+
+// parseDependency returns the provider name the dependency refers to and a
+// flag indicating whether the dependency is soft.
+func parseDependency(dep string) (string, bool) {
+	if strings.HasPrefix(dep, SoftDepPrefix) {
+		return dep[len(SoftDepPrefix):], true
+	}
+	return dep, false
+}
+
+// UnmetDependency describes a hard provider dependency which could not be
+// satisfied.
+type UnmetDependency struct {
+	Provider   string
+	Dependency string
+}
+
+// UnmetDependenciesError is returned by the repository if at least 1 of the
+// registered providers depends on a provider which is not registered.
+type UnmetDependenciesError struct {
+	Unmet []UnmetDependency
+}
+
+func (e *UnmetDependenciesError) Error() string {
+	descr := make([]string, 0, len(e.Unmet))
+	for _, u := range e.Unmet {
+		descr = append(descr, fmt.Sprintf("provider %q depends on unregistered provider %q", u.Provider, u.Dependency))
+	}
+	return fmt.Sprintf("unmet provider dependencies: %s", strings.Join(descr, "; "))
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"sort"
+	"strings"
+)
+
+// EnvNaming maps environment variable names to config keys and back (see
+// EnvProviderOptions.Naming). The names are always given and returned
+// without the provider prefix.
+type EnvNaming interface {
+	// KeyFor returns the config key for the variable name. The bool flag
+	// indicates whether the name could be mapped: the variable is skipped
+	// otherwise.
+	KeyFor(name string) (string, bool)
+	// VarFor returns the variable name for the config key.
+	VarFor(key Key) string
+}
+
+// CanonicalEnvNaming is the default EnvNaming: names are converted to
+// lowercase, an underscore is interpreted as a key separator and a double
+// underscore is interpreted as a singular underscore.
+// Example: FOO_BAR__BAZ <-> foo.bar_baz
+type CanonicalEnvNaming struct{}
+
+var _ EnvNaming = CanonicalEnvNaming{}
+
+// KeyFor satisfies EnvNaming interface.
+func (CanonicalEnvNaming) KeyFor(name string) (string, bool) {
+	return canonise(name), len(name) > 0
+}
+
+// VarFor satisfies EnvNaming interface.
+func (CanonicalEnvNaming) VarFor(key Key) string {
+	v := strings.Replace(key.String(), "_", "__", -1)
+	v = strings.Replace(v, KeySepCh, "_", -1)
+	return strings.ToUpper(v)
+}
+
+// SeparatorEnvNaming interprets a custom separator as a key separator: single
+// underscores and dashes are preserved as is. The names are converted to
+// lowercase.
+// Example (separator: __): FOO__BAR_BAZ <-> foo.bar_baz
+type SeparatorEnvNaming struct {
+	Separator string
+}
+
+var _ EnvNaming = (*SeparatorEnvNaming)(nil)
+
+// NewSeparatorEnvNaming returns a new instance of SeparatorEnvNaming.
+func NewSeparatorEnvNaming(sep string) *SeparatorEnvNaming {
+	return &SeparatorEnvNaming{Separator: sep}
+}
+
+// KeyFor satisfies EnvNaming interface. Names containing empty fragments are
+// rejected.
+func (sn *SeparatorEnvNaming) KeyFor(name string) (string, bool) {
+	chunks := strings.Split(strings.ToLower(name), sn.Separator)
+	for _, chunk := range chunks {
+		if len(chunk) == 0 {
+			return "", false
+		}
+	}
+	return strings.Join(chunks, KeySepCh), true
+}
+
+// VarFor satisfies EnvNaming interface.
+func (sn *SeparatorEnvNaming) VarFor(key Key) string {
+	return strings.ToUpper(strings.Join(key, sn.Separator))
+}
+
+// SchemaEnvNaming matches variable names against the keys known to the
+// repository schema. The matching is case-insensitive and both underscores
+// and dashes in the key fragments match an underscore in the name, so
+// camelCase keys and keys containing dashes are supported. Wildcard
+// fragments match a single name fragment (lowercased).
+// Example: FOO_BAR_BAZ -> foo.bar_baz if the schema declares foo.bar_baz.
+// Names matching no schema key are mapped by the fallback naming if defined
+// and skipped otherwise.
+type SchemaEnvNaming struct {
+	repo     *Repository
+	fallback EnvNaming
+}
+
+var _ EnvNaming = (*SchemaEnvNaming)(nil)
+
+// NewSchemaEnvNaming returns a new instance of SchemaEnvNaming. fallback
+// might be nil.
+func NewSchemaEnvNaming(repo *Repository, fallback EnvNaming) *SchemaEnvNaming {
+	return &SchemaEnvNaming{repo: repo, fallback: fallback}
+}
+
+// KeyFor satisfies EnvNaming interface.
+func (sn *SchemaEnvNaming) KeyFor(name string) (string, bool) {
+	if len(name) > 0 {
+		if key, ok := matchEnvName(sn.repo.loadMappers(), strings.Split(strings.ToUpper(name), "_"), nil); ok {
+			return key.String(), true
+		}
+	}
+	if sn.fallback != nil {
+		return sn.fallback.KeyFor(name)
+	}
+	return "", false
+}
+
+// VarFor satisfies EnvNaming interface: key separators, underscores and
+// dashes are converted to underscores.
+func (sn *SchemaEnvNaming) VarFor(key Key) string {
+	return envFragment(key.String())
+}
+
+// envFragment returns the name fragment matching the key fragment.
+func envFragment(s string) string {
+	s = strings.Replace(s, KeySepCh, "_", -1)
+	return strings.ToUpper(strings.Replace(s, "-", "_", -1))
+}
+
+// matchEnvName looks up the schema key matching the name tokens. Exact
+// matches have priority over wildcards.
+func matchEnvName(mn *MapperNode, tokens []string, key Key) (Key, bool) {
+	if len(tokens) == 0 {
+		return key, len(key) > 0
+	}
+	names := make([]string, 0, len(mn.Children))
+	for k := range mn.Children {
+		if k != "*" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		frag := strings.Split(envFragment(k), "_")
+		if len(frag) > len(tokens) || strings.Join(tokens[:len(frag)], "_") != strings.Join(frag, "_") {
+			continue
+		}
+		if res, ok := matchEnvName(mn.Children[k], tokens[len(frag):], key.child(k)); ok {
+			return res, true
+		}
+	}
+	if ch, ok := mn.Children["*"]; ok && len(tokens[0]) > 0 {
+		return matchEnvName(ch, tokens[1:], key.child(strings.ToLower(tokens[0])))
+	}
+	return nil, false
+}
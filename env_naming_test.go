@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestEnvNamingVarFor(t *testing.T) {
+	repo := NewRepository()
+	tests := []struct {
+		name   string
+		naming EnvNaming
+		key    string
+		want   string
+	}{
+		{"Canonical", CanonicalEnvNaming{}, "db.conn_string", "DB_CONN__STRING"},
+		{"Separator", NewSeparatorEnvNaming("__"), "db.conn_string", "DB__CONN_STRING"},
+		{"Schema", NewSchemaEnvNaming(repo, nil), "http.read-only", "HTTP_READ_ONLY"},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := testCase.naming.VarFor(NewKey(testCase.key)); got != testCase.want {
+				t.Fatalf("Unexpected var name: got: %q, want: %q", got, testCase.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"context"
 	"os"
 	"strings"
 )
@@ -21,15 +22,51 @@ func canonise(key string) string {
 // * Underscores are being transformed to dots in key part (before the first =).
 // * There must be exactly 1 `=` sign.
 // * Double underscores are converted to singulars and preserved with no dot-conversion.
+// The naming convention is configurable (see EnvProviderOptions).
 type EnvProvider struct {
 	weight   int
 	registry map[string]Value
 	ready    chan struct{}
+	state    healthState
+
+	name     string
+	prefix   string
+	infer    bool
+	raw      rawRegistry
+	naming   EnvNaming
+	bindings map[string]string
+	strict   bool
+}
 
-	prefix string
+// EnvProviderOptions is a set of optional EnvProvider settings.
+type EnvProviderOptions struct {
+	// Instance is the provider instance name: the provider is named
+	// env:<Instance> (see ProviderName). Required to register multiple env
+	// providers in the same repository.
+	Instance string
+	// Prefix is the prefix of the environment variables to read. The prefix
+	// is cut off the variable names.
+	Prefix string
+	// InferTypes enables the value type inference (see InferValue). The
+	// original input is available via Raw.
+	InferTypes bool
+	// Naming maps the variable names to config keys. Default:
+	// CanonicalEnvNaming.
+	Naming EnvNaming
+	// Bindings explicitly bind config keys to variable names: key -> full
+	// variable name. The bound variables are read regardless of the prefix
+	// and the naming.
+	Bindings map[string]string
+	// Strict makes the provider register the keys known to the repository
+	// schema only (see Repository.DefineSchema). The bound keys are always
+	// registered.
+	Strict bool
 }
 
 var _ Provider = (*EnvProvider)(nil)
+var _ ContextGetProvider = (*EnvProvider)(nil)
+var _ HealthProvider = (*EnvProvider)(nil)
+var _ RawProvider = (*EnvProvider)(nil)
 
 func NewEnvProvider(repo *Repository, weight int) (*EnvProvider, error) {
 	return NewEnvProviderWithPrefix(repo, weight, "CONFIG_")
@@ -37,21 +74,43 @@ func NewEnvProvider(repo *Repository, weight int) (*EnvProvider, error) {
 
 // NewEnvProvider returns a new instance of EnvProvider.
 func NewEnvProviderWithPrefix(repo *Repository, weight int, prefix string) (*EnvProvider, error) {
+	return NewEnvProviderWithOptions(repo, weight, &EnvProviderOptions{Prefix: prefix})
+}
+
+// NewEnvProviderWithOptions returns a new instance of EnvProvider configured
+// according to the options.
+func NewEnvProviderWithOptions(repo *Repository, weight int, options *EnvProviderOptions) (*EnvProvider, error) {
+	naming := options.Naming
+	if naming == nil {
+		naming = CanonicalEnvNaming{}
+	}
+	bindings := make(map[string]string, len(options.Bindings))
+	for k, v := range options.Bindings {
+		bindings[k] = v
+	}
 	prov := &EnvProvider{
-		weight: weight,
-		ready:  make(chan struct{}),
-		prefix: prefix,
+		name:     ProviderName("env", options.Instance),
+		weight:   weight,
+		ready:    make(chan struct{}),
+		prefix:   options.Prefix,
+		infer:    options.InferTypes,
+		naming:   naming,
+		bindings: bindings,
+		strict:   options.Strict,
+	}
+	if err := repo.RegisterNewProvider(prov); err != nil {
+		return nil, err
 	}
-	repo.RegisterProvider(prov)
 
 	return prov, nil
 }
 
-// Name returns provider name: env
-func (ep *EnvProvider) Name() string { return "env" }
+// Name returns provider name: env or env:<instance>
+func (ep *EnvProvider) Name() string { return ep.name }
 
-// Depends returns provider dependencies: default
-func (ep *EnvProvider) Depends() []string { return []string{"default"} }
+// Depends returns provider dependencies: default (soft). The defaults
+// are optional: the provider serves its own values regardless.
+func (ep *EnvProvider) Depends() []string { return []string{SoftDependency("default")} }
 
 // Weight returns provider weight
 func (ep *EnvProvider) Weight() int { return ep.weight }
@@ -59,23 +118,37 @@ func (ep *EnvProvider) Weight() int { return ep.weight }
 // SetUp takes the list of env vars and canonizes them before registration in
 // repo. Env vars are expected to be in form FLOW_<K>=<v>. FLOW_ preffix
 // would be cleared out.
-func (ep *EnvProvider) SetUp(repo *Repository) error {
+func (ep *EnvProvider) SetUp(repo *Repository) (err error) {
 	defer close(ep.ready)
+	defer func() { ep.state.loaded(err) }()
 	registry := make(map[string]Value)
+	raw := newRawRegistry(ep.infer)
+	bound := make(map[string]string, len(ep.bindings))
+	for k, name := range ep.bindings {
+		bound[name] = k
+	}
 	var k string
 	var v interface{}
 
 	for _, kv := range envVars() {
-		if !strings.HasPrefix(kv, ep.prefix) {
+		name, val, hasVal := kv, "", false
+		if ix := strings.Index(kv, "="); ix != -1 {
+			name, val, hasVal = kv[:ix], kv[ix+1:], true
+		}
+		if bk, ok := bound[name]; ok {
+			k = bk
+		} else if !strings.HasPrefix(name, ep.prefix) {
+			continue
+		} else if k, ok = ep.naming.KeyFor(name[len(ep.prefix):]); !ok {
+			continue
+		} else if ep.strict && (repo == nil || !schemaKnows(repo.loadMappers(), NewKey(k))) {
 			continue
 		}
-		kv = kv[len(ep.prefix):]
-		if ix := strings.Index(kv, "="); ix != -1 {
-			k, v = kv[:ix], kv[ix+1:]
+		if hasVal {
+			v = raw.parse(k, val)
 		} else {
-			k, v = kv, true
+			v = true
 		}
-		k = canonise(k)
 		registry[k] = v
 		if repo != nil {
 			if err := repo.RegisterKey(NewKey(k), ep); err != nil {
@@ -85,18 +158,57 @@ func (ep *EnvProvider) SetUp(repo *Repository) error {
 	}
 
 	ep.registry = registry
+	ep.raw = raw
 
 	return nil
 }
 
-// TearDown is a no-op operation for CliProvider
-func (ep *EnvProvider) TearDown(_ *Repository) error { return nil }
+// VarFor returns the name of the environment variable the key is read from:
+// the bound variable name or the prefixed name produced by the naming.
+func (ep *EnvProvider) VarFor(key Key) string {
+	if name, ok := ep.bindings[key.String()]; ok {
+		return name
+	}
+	return ep.prefix + ep.naming.VarFor(key)
+}
+
+// Raw returns the original input for the key if the value type has been
+// inferred.
+func (ep *EnvProvider) Raw(key Key) (string, bool) {
+	if !isReady(ep.ready) {
+		return "", false
+	}
+	return ep.raw.get(key)
+}
+
+// TearDown resets the provider health: the provider is not ready anymore.
+func (ep *EnvProvider) TearDown(_ *Repository) error {
+	ep.state.reset()
+	return nil
+}
 
 // Get is the primary method to fetch values from the provider registry.
+// Never blocks: returns nothing until the provider is set up.
 func (ep *EnvProvider) Get(key Key) (*KeyValue, bool) {
-	<-ep.ready
+	if !isReady(ep.ready) {
+		return nil, false
+	}
+	return ep.GetContext(context.Background(), key)
+}
+
+// GetContext is the same as Get, but waits for the provider to get ready
+// until the context is done. A context which is never done does not wait.
+func (ep *EnvProvider) GetContext(ctx context.Context, key Key) (*KeyValue, bool) {
+	if !waitReady(ctx, ep.ready) {
+		return nil, false
+	}
 	if val, ok := ep.registry[key.String()]; ok {
 		return &KeyValue{Key: key, Value: val}, ok
 	}
 	return nil, false
 }
+
+// Health returns the provider health report.
+func (ep *EnvProvider) Health() ProviderHealth {
+	return ep.state.health(ep.ready)
+}
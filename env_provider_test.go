@@ -97,3 +97,155 @@ func TestEnvProviderSetUp(t *testing.T) {
 		})
 	}
 }
+
+func TestEnvProviderVarFor(t *testing.T) {
+	ep, err := NewEnvProvider(NewRepository(), 0)
+	if err != nil {
+		t.Fatalf("Failed to initialize a new env provider: %s", err)
+	}
+	tests := map[string]string{
+		"system.maxprocs":       "CONFIG_SYSTEM_MAXPROCS",
+		"pipeline.tcp_rcv.bind": "CONFIG_PIPELINE_TCP__RCV_BIND",
+		"system.admin.enabled":  "CONFIG_SYSTEM_ADMIN_ENABLED",
+	}
+	for key, want := range tests {
+		got := ep.VarFor(NewKey(key))
+		if got != want {
+			t.Fatalf("Unexpected var name for key %q: got: %q, want: %q", key, got, want)
+		}
+		if k := canonise(got[len(ep.prefix):]); k != key {
+			t.Fatalf("Var name %q does not canonise back to %q: got: %q", got, key, k)
+		}
+	}
+}
+
+func TestEnvProviderWithOptions(t *testing.T) {
+	schema := map[string]Schema{
+		"http": map[string]Schema{
+			"maxConns":  ToInt,
+			"read-only": ToBool,
+		},
+		"db": map[string]Schema{
+			"conn_string": ToStr,
+		},
+		"plugins": map[string]Schema{
+			"*": map[string]Schema{
+				"path": ToStr,
+			},
+		},
+	}
+	env := []string{
+		"APP_HTTP_MAXCONNS=10",
+		"APP_HTTP_READ_ONLY=true",
+		"APP_DB_CONN_STRING=host=db",
+		"APP_PLUGINS_KAFKA_PATH=/opt/kafka",
+		"APP_UNKNOWN__KEY=1",
+		"DATABASE_URL=postgres://db",
+	}
+	tests := []struct {
+		name         string
+		options      func(*Repository) *EnvProviderOptions
+		wantRegistry map[string]Value
+	}{
+		{
+			"Separator naming",
+			func(*Repository) *EnvProviderOptions {
+				return &EnvProviderOptions{Prefix: "APP_", Naming: NewSeparatorEnvNaming("__")}
+			},
+			map[string]Value{
+				"http_maxconns":      "10",
+				"http_read_only":     "true",
+				"db_conn_string":     "host=db",
+				"plugins_kafka_path": "/opt/kafka",
+				"unknown.key":        "1",
+			},
+		},
+		{
+			"Schema naming with a fallback",
+			func(repo *Repository) *EnvProviderOptions {
+				return &EnvProviderOptions{Prefix: "APP_", Naming: NewSchemaEnvNaming(repo, NewSeparatorEnvNaming("__"))}
+			},
+			map[string]Value{
+				"http.maxConns":      "10",
+				"http.read-only":     "true",
+				"db.conn_string":     "host=db",
+				"plugins.kafka.path": "/opt/kafka",
+				"unknown.key":        "1",
+			},
+		},
+		{
+			"Strict mode with bindings",
+			func(repo *Repository) *EnvProviderOptions {
+				return &EnvProviderOptions{
+					Prefix:   "APP_",
+					Naming:   NewSchemaEnvNaming(repo, nil),
+					Bindings: map[string]string{"db.url": "DATABASE_URL"},
+					Strict:   true,
+				}
+			},
+			map[string]Value{
+				"http.maxConns":      "10",
+				"http.read-only":     "true",
+				"db.conn_string":     "host=db",
+				"plugins.kafka.path": "/opt/kafka",
+				"db.url":             "postgres://db",
+			},
+		},
+	}
+
+	oldEnvVars := envVars
+	defer func() { envVars = oldEnvVars }()
+	envVars = func() []string { return env }
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := NewRepository()
+			if err := repo.DefineSchema(schema); err != nil {
+				t.Fatalf("Failed to define the schema: %s", err)
+			}
+			prov, err := NewEnvProviderWithOptions(repo, 0, testCase.options(repo))
+			if err != nil {
+				t.Fatalf("Failed to initialize a new env provider: %s", err)
+			}
+			if err := prov.SetUp(repo); err != nil {
+				t.Fatalf("Failed to set up env provider: %s", err)
+			}
+			if !reflect.DeepEqual(prov.registry, testCase.wantRegistry) {
+				t.Fatalf("Unexpected registry: got: %#v, want: %#v", prov.registry, testCase.wantRegistry)
+			}
+		})
+	}
+}
+
+func TestEnvProviderInstances(t *testing.T) {
+	oldEnvVars := envVars
+	defer func() { envVars = oldEnvVars }()
+	envVars = func() []string { return []string{"APP_FOO=app", "LEGACY_FOO=legacy", "LEGACY_BAR=legacy"} }
+
+	repo := NewRepository()
+	if _, err := NewEnvProviderWithOptions(repo, 10, &EnvProviderOptions{Prefix: "LEGACY_", Instance: "LEGACY_"}); err != nil {
+		t.Fatalf("Failed to initialize a new env provider: %s", err)
+	}
+	if _, err := NewEnvProviderWithOptions(repo, 20, &EnvProviderOptions{Prefix: "APP_", Instance: "APP_"}); err != nil {
+		t.Fatalf("Failed to initialize a new env provider: %s", err)
+	}
+	if _, err := NewEnvProviderWithOptions(repo, 30, &EnvProviderOptions{Prefix: "OTHER_", Instance: "APP_"}); err == nil {
+		t.Fatalf("Expected a duplicate provider instance to be rejected")
+	}
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+
+	want := map[string]Value{"foo": "app", "bar": "legacy"}
+	for k, v := range want {
+		if got, ok := repo.Get(NewKey(k)); !ok || got != v {
+			t.Fatalf("Unexpected value for key %q: got: %#v, want: %#v", k, got, v)
+		}
+	}
+	health := repo.Health()
+	for _, name := range []string{"env:APP_", "env:LEGACY_"} {
+		if h, ok := health.Providers[name]; !ok || !h.Ready {
+			t.Fatalf("Expected provider %q to be ready: %+v", name, health.Providers)
+		}
+	}
+}
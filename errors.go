@@ -0,0 +1,43 @@
+package config
+
+import (
+	"errors"
+	"strings"
+)
+
+// MultiError is an aggregation of multiple errors, e.g. errors returned by
+// several providers while setting up the repository.
+type MultiError struct {
+	Errors []error
+}
+
+func (me *MultiError) Error() string {
+	descr := make([]string, 0, len(me.Errors))
+	for _, err := range me.Errors {
+		descr = append(descr, err.Error())
+	}
+	return strings.Join(descr, "; ")
+}
+
+// Is reports whether any of the aggregated errors matches the target.
+// Makes MultiError compatible with errors.Is.
+func (me *MultiError) Is(target error) bool {
+	for _, err := range me.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// combineErrors returns nil if the list is empty, the error itself if there
+// is exactly 1 error and a MultiError otherwise.
+func combineErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	}
+	return &MultiError{Errors: errs}
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProviderHealth describes the state of a provider config source.
+type ProviderHealth struct {
+	// Ready indicates whether the provider has been set up and serves values.
+	Ready bool
+	// LastLoad is the time of the last successful config source load.
+	// Zero if unknown.
+	LastLoad time.Time
+	// LastError is the error of the last failed load (if any). It is reset
+	// by a successful load.
+	LastError error
+	// Stale indicates the provider serves values which might be out of date
+	// (e.g. the config source could not be re-read).
+	Stale bool
+}
+
+// Healthy reports whether the provider is ready and serves up-to-date values.
+func (ph ProviderHealth) Healthy() bool {
+	return ph.Ready && ph.LastError == nil && !ph.Stale
+}
+
+// HealthProvider is an optional interface for providers reporting their
+// health. Providers not implementing it are considered healthy as soon as
+// the repository has set them up successfully.
+type HealthProvider interface {
+	Health() ProviderHealth
+}
+
+// Health is the aggregated repository health: a health report per provider
+// name.
+type Health struct {
+	Providers map[string]ProviderHealth
+}
+
+// Healthy reports whether all providers are healthy. Intended for readiness
+// probes.
+func (h *Health) Healthy() bool {
+	for _, ph := range h.Providers {
+		if !ph.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+// Err returns an error describing every unhealthy provider or nil if all
+// providers are healthy.
+func (h *Health) Err() error {
+	names := make([]string, 0, len(h.Providers))
+	for name := range h.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	errs := make([]error, 0)
+	for _, name := range names {
+		ph := h.Providers[name]
+		switch {
+		case !ph.Ready && ph.LastError != nil:
+			errs = append(errs, fmt.Errorf("provider %q is not ready: %w", name, ph.LastError))
+		case !ph.Ready:
+			errs = append(errs, fmt.Errorf("provider %q is not ready", name))
+		case ph.LastError != nil:
+			errs = append(errs, fmt.Errorf("provider %q is unhealthy: %w", name, ph.LastError))
+		case ph.Stale:
+			errs = append(errs, fmt.Errorf("provider %q serves stale values", name))
+		}
+	}
+	return combineErrors(errs)
+}
+
+// Health collects the health reports of all registered providers.
+func (repo *Repository) Health() *Health {
+	providers := repo.providerMap()
+	h := &Health{Providers: make(map[string]ProviderHealth, len(providers))}
+	for name, prov := range providers {
+		if hp, ok := prov.(HealthProvider); ok {
+			h.Providers[name] = hp.Health()
+			continue
+		}
+		h.Providers[name] = ProviderHealth{Ready: repo.isSetUp(name)}
+	}
+	return h
+}
+
+// isSetUp reports whether the repository has set up the provider.
+func (repo *Repository) isSetUp(name string) bool {
+	repo.mx.Lock()
+	defer repo.mx.Unlock()
+	return repo.setUp[name]
+}
+
+// markSetUp records the provider set up state.
+func (repo *Repository) markSetUp(name string, isSetUp bool) {
+	repo.mx.Lock()
+	defer repo.mx.Unlock()
+	if isSetUp {
+		repo.setUp[name] = true
+	} else {
+		delete(repo.setUp, name)
+	}
+}
+
+// isReady reports whether the ready channel has been closed. Never blocks.
+func isReady(ready chan struct{}) bool {
+	select {
+	case <-ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// healthState tracks the config source loads of a built-in provider.
+type healthState struct {
+	mx        sync.RWMutex
+	lastLoad  time.Time
+	lastError error
+}
+
+// loaded records the outcome of a config source load.
+func (hs *healthState) loaded(err error) {
+	hs.mx.Lock()
+	defer hs.mx.Unlock()
+	if err != nil {
+		hs.lastError = err
+		return
+	}
+	hs.lastLoad = time.Now()
+	hs.lastError = nil
+}
+
+// reset forgets the config source loads: a torn down provider is not ready.
+func (hs *healthState) reset() {
+	hs.mx.Lock()
+	defer hs.mx.Unlock()
+	hs.lastLoad = time.Time{}
+	hs.lastError = nil
+}
+
+// health builds a provider health report. A provider is ready once the ready
+// channel is closed and the source has been loaded at least once. A provider
+// which failed to re-load the source after a successful load serves stale
+// values.
+func (hs *healthState) health(ready chan struct{}) ProviderHealth {
+	hs.mx.RLock()
+	defer hs.mx.RUnlock()
+	loaded := !hs.lastLoad.IsZero()
+	return ProviderHealth{
+		Ready:     isReady(ready) && loaded,
+		LastLoad:  hs.lastLoad,
+		LastError: hs.lastError,
+		Stale:     loaded && hs.lastError != nil,
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestRepositoryHealth(t *testing.T) {
+	repo := NewRepository()
+	def, err := NewDefaultProviderWithDefaults(repo, 0, map[string]Value{"foo": 42})
+	if err != nil {
+		t.Fatalf("Failed to initialize a new default provider: %s", err)
+	}
+	repo.RegisterProvider(newHookTestProv("plugin", []string{"default"}, nil))
+
+	if kv, ok := def.Get(NewKey("foo")); ok {
+		t.Fatalf("Expected Get to return nothing before set up, got: %#v", kv)
+	}
+	health := repo.Health()
+	if health.Healthy() {
+		t.Fatalf("Expected the repo to be unhealthy before set up")
+	}
+	wantErr := `provider "default" is not ready; provider "plugin" is not ready`
+	if err := health.Err(); err == nil || err.Error() != wantErr {
+		t.Fatalf("Unexpected health error: got: %v, want: %s", err, wantErr)
+	}
+
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+	health = repo.Health()
+	if !health.Healthy() {
+		t.Fatalf("Expected the repo to be healthy, got: %s", health.Err())
+	}
+	if health.Providers["default"].LastLoad.IsZero() {
+		t.Fatalf("Expected the default provider to report the last load time")
+	}
+
+	if err := repo.TearDown(); err != nil {
+		t.Fatalf("Failed to tear down the repo: %s", err)
+	}
+	if repo.Health().Providers["plugin"].Ready {
+		t.Fatalf("Expected the plugin provider to be not ready after tear down")
+	}
+}
+
+func TestYamlProviderHealth(t *testing.T) {
+	src := []byte("system:\n  maxprocs: 4\n")
+
+	// Redefining the original value
+	oldReadRaw := readRaw
+	defer func() { readRaw = oldReadRaw }()
+	readRaw = func(source string) (map[interface{}]interface{}, error) {
+		out := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(src, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	repo := NewRepository()
+	prov, err := NewYamlProviderFromSource(repo, 0, &YamlProviderOptions{}, "dummy.dummy")
+	if err != nil {
+		t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+	}
+	if err := prov.SetUp(repo); err != nil {
+		t.Fatalf("Failed to set up yaml provider: %s", err)
+	}
+	if h := prov.Health(); !h.Healthy() {
+		t.Fatalf("Expected the provider to be healthy, got: %#v", h)
+	}
+
+	src = []byte("system: [")
+	if err := prov.reload(); err == nil {
+		t.Fatalf("Expected the reload to fail")
+	}
+	h := prov.Health()
+	if !h.Ready || !h.Stale || h.LastError == nil {
+		t.Fatalf("Expected the provider to be ready and stale, got: %#v", h)
+	}
+	if v, ok := repo.Get(NewKey("system.maxprocs")); !ok || v != 4 {
+		t.Fatalf("Expected the provider to serve the stale value, got: %#v", v)
+	}
+	wantErr := fmt.Sprintf("provider %q is unhealthy: %s", "yaml", h.LastError)
+	if err := repo.Health().Err(); err == nil || err.Error() != wantErr {
+		t.Fatalf("Unexpected health error: got: %v, want: %s", err, wantErr)
+	}
+
+	src = []byte("system:\n  maxprocs: 8\n")
+	if err := prov.reload(); err != nil {
+		t.Fatalf("Failed to reload yaml provider: %s", err)
+	}
+	if h := prov.Health(); !h.Healthy() {
+		t.Fatalf("Expected the provider to recover, got: %#v", h)
+	}
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RawProvider is an optional interface for providers serving values parsed
+// from a textual input (see CliProviderOptions.InferTypes). Raw returns the
+// original input the value for the key has been produced from. The raw input
+// is shown in `Explain()` output and is used as a fallback if the produced
+// value could not be mapped according to the schema.
+type RawProvider interface {
+	Raw(key Key) (string, bool)
+}
+
+// InferValue converts a textual input to the most specific value type it
+// looks like. The recognised types are (in the order of precedence):
+// * bool: true, false (case-insensitive)
+// * int: 42, -1 (but not 007 or +1)
+// * float64: 3.14, 1e-3
+// * time.Duration: 1h30m, 250ms
+// * JSON arrays and objects: [1,2,3], {"foo":"bar"}
+// * comma-separated lists ([]string, the items are trimmed): a,b,c
+// The input is returned as is otherwise.
+func InferValue(s string) Value {
+	switch strings.ToLower(s) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	// Ints are expected in the canonical form: 007 is not a number
+	if i, err := strconv.Atoi(s); err == nil {
+		if strconv.Itoa(i) != s {
+			return s
+		}
+		return i
+	}
+	// A digit is required: ParseFloat accepts "inf" and "nan" literals
+	if f, err := strconv.ParseFloat(s, 64); err == nil && strings.ContainsAny(s, "0123456789") {
+		return f
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d
+	}
+	if strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{") {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err == nil {
+			return v
+		}
+	}
+	if strings.Contains(s, ",") {
+		chunks := strings.Split(s, ",")
+		for ix := range chunks {
+			chunks[ix] = strings.TrimSpace(chunks[ix])
+		}
+		return chunks
+	}
+	return s
+}
+
+// providerRaw returns the raw input for the key if the provider keeps it.
+func providerRaw(prov Provider, key Key) (string, bool) {
+	if rp, ok := prov.(RawProvider); ok {
+		return rp.Raw(key)
+	}
+	return "", false
+}
+
+// rawRegistry keeps the values parsed from a textual input along with the
+// input itself if the type inference is enabled. A list value collected from
+// multiple inputs keeps the input of every item: the raw input of the list
+// is the comma-separated items input (the way InferValue reads lists).
+type rawRegistry struct {
+	infer bool
+	raw   map[string][]string
+}
+
+func newRawRegistry(infer bool) rawRegistry {
+	return rawRegistry{infer: infer, raw: make(map[string][]string)}
+}
+
+// parse returns the value for the raw input and memorises the input if the
+// value has been inferred.
+func (rr *rawRegistry) parse(key string, raw string) Value {
+	if !rr.infer {
+		return raw
+	}
+	rr.raw[key] = []string{raw}
+	return InferValue(raw)
+}
+
+// parseItem is the same as parse, but the value is a list item: the input is
+// appended to the list items input. The first item starts a new list. The
+// list input is kept only if every item has been parsed from a raw input.
+func (rr *rawRegistry) parseItem(key string, raw string, first bool) Value {
+	if !rr.infer {
+		return raw
+	}
+	if items, ok := rr.raw[key]; ok || first {
+		rr.raw[key] = append(items, raw)
+	}
+	return InferValue(raw)
+}
+
+// forget drops the raw input for the key.
+func (rr *rawRegistry) forget(key string) {
+	delete(rr.raw, key)
+}
+
+func (rr *rawRegistry) get(key Key) (string, bool) {
+	items, ok := rr.raw[key.String()]
+	if !ok {
+		return "", false
+	}
+	return strings.Join(items, ","), true
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInferValue(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Value
+	}{
+		{"true", true},
+		{"FALSE", false},
+		{"42", 42},
+		{"-1", -1},
+		{"007", "007"},
+		{"3.14", 3.14},
+		{"1e-3", 0.001},
+		{"inf", "inf"},
+		{"1h30m", 90 * time.Minute},
+		{"[1,\"a\"]", []interface{}{1.0, "a"}},
+		{"{\"foo\":\"bar\"}", map[string]interface{}{"foo": "bar"}},
+		{"[not json", "[not json"},
+		{"a, b,c", []string{"a", "b", "c"}},
+		{"hello", "hello"},
+		{"", ""},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.input, func(t *testing.T) {
+			if got := InferValue(testCase.input); !reflect.DeepEqual(got, testCase.want) {
+				t.Fatalf("Unexpected value: got: %#v, want: %#v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestInferTypes(t *testing.T) {
+	oldEnvVars := envVars
+	defer func() { envVars = oldEnvVars }()
+	envVars = func() []string {
+		return []string{"APP_DB_PORT=5432", "APP_DB_PASSWORD=42"}
+	}
+
+	repo := NewRepository()
+	if err := repo.DefineSchema(map[string]Schema{
+		"db": map[string]Schema{
+			"user":     ToStr,
+			"name":     ToStr,
+			"password": Secret(ToStr),
+		},
+	}); err != nil {
+		t.Fatalf("Failed to define the schema: %s", err)
+	}
+	if _, err := NewEnvProviderWithOptions(repo, 10, &EnvProviderOptions{Prefix: "APP_", InferTypes: true}); err != nil {
+		t.Fatalf("Failed to initialize a new env provider: %s", err)
+	}
+	cli, err := NewCliProviderWithOptions(repo, 20, &CliProviderOptions{
+		Args: []string{
+			"-o", "db.timeout=5s", "-o", "db.hosts=a,b", "-o", "db.debug", "--db.user=admin,root",
+			"-o", "db.name=1", "-o", "db.name+=app",
+		},
+		InferTypes: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to initialize a new cli provider: %s", err)
+	}
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+
+	want := map[string]Value{
+		"db.port":    5432,
+		"db.timeout": 5 * time.Second,
+		"db.hosts":   []string{"a", "b"},
+		"db.debug":   true,
+		// An inferred list does not fit the schema: the raw input is used
+		"db.user":     "admin,root",
+		"db.name":     "1,app",
+		"db.password": "42",
+	}
+	for k, v := range want {
+		if got, ok := repo.Get(NewKey(k)); !ok || !reflect.DeepEqual(got, v) {
+			t.Fatalf("Unexpected value for key %q: got: %#v, want: %#v", k, got, v)
+		}
+	}
+	if raw, ok := cli.Raw(NewKey("db.name")); !ok || raw != "1,app" {
+		t.Fatalf("Unexpected raw input for a repeated key: got: %q, %t", raw, ok)
+	}
+	if _, ok := cli.Raw(NewKey("db.debug")); ok {
+		t.Fatalf("No raw input is expected for a flag without a value")
+	}
+
+	db := repo.Explain()["db"].(map[string]interface{})
+	port := db["port"].(map[string]interface{})["__value__"].([]map[string]interface{})
+	if raw := port[0]["raw"]; raw != "5432" {
+		t.Fatalf("Unexpected raw input in explain: %#v", raw)
+	}
+	password := db["password"].(map[string]interface{})["__value__"].([]map[string]interface{})
+	if _, ok := password[0]["raw"].(SecretValue); !ok {
+		t.Fatalf("Expected the raw secret input to be redacted: %#v", password[0]["raw"])
+	}
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type setUpResult struct {
+	prov Provider
+	err  error
+}
+
+// SetUpContext sets up the registered providers along the dependency graph.
+// Every provider whose dependencies have been set up starts immediately:
+// independent providers are set up concurrently.
+//
+// The set up is transactional: if a provider fails to set up, no new
+// providers are started. Once the providers being set up are done, all
+// successfully set up providers are torn down in the reverse dependency
+// order and the keys registered by them (as well as the keys registered by
+// the failed providers) are removed. All errors (including the rollback
+// ones) are aggregated in a MultiError (a single error is returned as is).
+//
+// The context cancellation interrupts the process the same way: the
+// providers being set up are abandoned and the set up is rolled back. Every
+// provider SetUp is limited by `RepositoryOptions.SetUpTimeout` if defined.
+// An abandoned provider SetUp can not be rolled back.
+func (repo *Repository) SetUpContext(ctx context.Context) error {
+	top, err := repo.providerTopology()
+	if err != nil {
+		return err
+	}
+	// Sort detects dependency cycles and defines the launch order
+	sorted, err := top.Sort()
+	if err != nil {
+		return err
+	}
+
+	pending := make(map[Provider]int, len(sorted))
+	dependents := make(map[Provider][]Provider, len(sorted))
+	for edge := range top.Edges {
+		from, to := edge.From.(Provider), edge.To.(Provider)
+		pending[from]++
+		dependents[to] = append(dependents[to], from)
+	}
+
+	results := make(chan setUpResult, len(sorted))
+	running := 0
+	started := make(map[Provider]bool, len(sorted))
+	start := func(prov Provider) {
+		running++
+		started[prov] = true
+		go func() {
+			results <- setUpResult{prov: prov, err: repo.setUpProvider(ctx, prov)}
+		}()
+	}
+
+	for _, node := range sorted {
+		if prov := node.(Provider); pending[prov] == 0 {
+			start(prov)
+		}
+	}
+
+	errs := make([]error, 0)
+	done := make(map[Provider]bool, len(sorted))
+	failed := make(map[Provider]bool)
+	for running > 0 {
+		res := <-results
+		running--
+		if res.err != nil {
+			errs = append(errs, res.err)
+			failed[res.prov] = true
+			continue
+		}
+		done[res.prov] = true
+		if len(errs) > 0 || ctx.Err() != nil {
+			continue
+		}
+		for _, dep := range dependents[res.prov] {
+			pending[dep]--
+			if pending[dep] == 0 {
+				start(dep)
+			}
+		}
+	}
+
+	if len(errs) == 0 && len(started) < len(sorted) && ctx.Err() != nil {
+		errs = append(errs, fmt.Errorf("set up has been interrupted: %w", ctx.Err()))
+	}
+	if len(errs) > 0 {
+		// Rollback: the providers are torn down in the reverse order
+		rollback := make([]Provider, 0, len(done))
+		for _, node := range sorted {
+			if prov := node.(Provider); done[prov] {
+				rollback = append(rollback, prov)
+			}
+		}
+		errs = append(errs, repo.tearDownProviders(rollback)...)
+		// The keys registered by the rolled back providers as well as the
+		// ones registered by the failed providers are not served anymore
+		for _, node := range sorted {
+			if prov := node.(Provider); done[prov] || failed[prov] {
+				repo.removeProviderKeys(prov)
+			}
+		}
+	}
+
+	return combineErrors(errs)
+}
+
+// tearDownProviders calls TearDown for every provider in the reverse order.
+// A failure does not stop the process: all errors are collected and
+// returned.
+func (repo *Repository) tearDownProviders(providers []Provider) []error {
+	errs := make([]error, 0)
+	for ix := len(providers) - 1; ix >= 0; ix-- {
+		prov := providers[ix]
+		if err := repo.tearDownProvider(prov); err != nil {
+			errs = append(errs, fmt.Errorf("provider %q failed to tear down: %w", prov.Name(), err))
+		}
+	}
+	return errs
+}
+
+// tearDownProvider calls the provider TearDown and emits the corresponding
+// event.
+func (repo *Repository) tearDownProvider(prov Provider) error {
+	repo.markSetUp(prov.Name(), false)
+	start := time.Now()
+	err := prov.TearDown(repo)
+	repo.Emit(Event{Type: EventTearDown, Provider: prov.Name(), Err: err, Duration: time.Since(start)})
+	return err
+}
+
+// setUpProvider calls the provider SetUp respecting the context cancellation
+// and the SetUp timeout. An interrupted provider SetUp keeps running in
+// background: there is no way to stop it.
+func (repo *Repository) setUpProvider(ctx context.Context, prov Provider) error {
+	if timeout := repo.options.SetUpTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- providerSetUp(ctx, prov, repo)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	repo.Emit(Event{Type: EventSetUp, Provider: prov.Name(), Err: err, Duration: time.Since(start)})
+	if err != nil {
+		return fmt.Errorf("provider %q failed to set up: %w", prov.Name(), err)
+	}
+	repo.markSetUp(prov.Name(), true)
+	// The lookups made while the provider was getting ready might have
+	// cached misses
+	repo.invalidate(nil)
+	repo.auditChange(prov, nil)
+	return nil
+}
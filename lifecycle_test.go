@@ -0,0 +1,287 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetUpConcurrent(t *testing.T) {
+	repo := NewRepositoryWithOptions(&RepositoryOptions{SetUpTimeout: 5 * time.Second})
+
+	// Both providers wait for each other: a sequential set up would time out.
+	var barrier sync.WaitGroup
+	barrier.Add(2)
+	wait := func() error {
+		barrier.Done()
+		barrier.Wait()
+		return nil
+	}
+	var mx sync.Mutex
+	log := make([]string, 0)
+	logged := func(name string, f func() error) func() error {
+		return func() error {
+			err := f()
+			mx.Lock()
+			defer mx.Unlock()
+			log = append(log, name)
+			return err
+		}
+	}
+	noop := func() error { return nil }
+
+	repo.RegisterProvider(newHookTestProv("env", []string{}, logged("env", wait)))
+	repo.RegisterProvider(newHookTestProv("cli", []string{}, logged("cli", wait)))
+	repo.RegisterProvider(newHookTestProv("yaml", []string{"cli", "env"}, logged("yaml", noop)))
+
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+	if len(log) != 3 || log[2] != "yaml" {
+		t.Fatalf("Unexpected set up order: %v", log)
+	}
+}
+
+func TestSetUpTimeout(t *testing.T) {
+	repo := NewRepositoryWithOptions(&RepositoryOptions{SetUpTimeout: 10 * time.Millisecond})
+	block := make(chan struct{})
+	defer close(block)
+	repo.RegisterProvider(newHookTestProv("remote", []string{}, func() error {
+		<-block
+		return nil
+	}))
+
+	err := repo.SetUp()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Unexpected error: got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSetUpContextCancel(t *testing.T) {
+	repo := NewRepository()
+	block := make(chan struct{})
+	defer close(block)
+	started := make(chan struct{})
+	repo.RegisterProvider(newHookTestProv("remote", []string{}, func() error {
+		close(started)
+		<-block
+		return nil
+	}))
+	repo.RegisterProvider(newHookTestProv("yaml", []string{"remote"}, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	err := repo.SetUpContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Unexpected error: got: %v, want: %v", err, context.Canceled)
+	}
+}
+
+func TestSetUpErrorAggregation(t *testing.T) {
+	repo := NewRepository()
+	fail := func(name string) func() error {
+		return func() error { return fmt.Errorf("%s is broken", name) }
+	}
+	repo.RegisterProvider(newHookTestProv("a", []string{}, fail("a")))
+	repo.RegisterProvider(newHookTestProv("b", []string{}, fail("b")))
+
+	err := repo.SetUp()
+	merr, isMulti := err.(*MultiError)
+	if !isMulti {
+		t.Fatalf("Expected a MultiError, got: %#v", err)
+	}
+	gotErrs := make([]string, 0, len(merr.Errors))
+	for _, e := range merr.Errors {
+		gotErrs = append(gotErrs, e.Error())
+	}
+	sort.Strings(gotErrs)
+	wantErrs := []string{
+		`provider "a" failed to set up: a is broken`,
+		`provider "b" failed to set up: b is broken`,
+	}
+	if !reflect.DeepEqual(gotErrs, wantErrs) {
+		t.Fatalf("Unexpected errors: got: %v, want: %v", gotErrs, wantErrs)
+	}
+}
+
+func TestSetUpRollback(t *testing.T) {
+	repo := NewRepository()
+	log := make([]string, 0)
+	provs := []*namedTestProv{
+		newHookTestProv("default", []string{}, nil),
+		newHookTestProv("cli", []string{"default"}, nil),
+		newHookTestProv("yaml", []string{"cli"}, func() error { return fmt.Errorf("yaml is broken") }),
+		newHookTestProv("plugin", []string{"yaml"}, nil),
+	}
+	for _, prov := range provs {
+		prov := prov
+		prov.tearDown = func() error {
+			log = append(log, prov.name)
+			if prov.name == "cli" {
+				return fmt.Errorf("cli is stuck")
+			}
+			return nil
+		}
+		repo.RegisterProvider(prov)
+	}
+
+	err := repo.SetUp()
+	want := &MultiError{Errors: []error{
+		fmt.Errorf("provider %q failed to set up: %w", "yaml", fmt.Errorf("yaml is broken")),
+		fmt.Errorf("provider %q failed to tear down: %w", "cli", fmt.Errorf("cli is stuck")),
+	}}
+	if err == nil || err.Error() != want.Error() {
+		t.Fatalf("Unexpected error: got: %v, want: %v", err, want)
+	}
+	if want := []string{"cli", "default"}; !reflect.DeepEqual(log, want) {
+		t.Fatalf("Unexpected rollback order: got: %v, want: %v", log, want)
+	}
+}
+
+func TestTearDown(t *testing.T) {
+	repo := NewRepository()
+	log := make([]string, 0)
+	provs := []*namedTestProv{
+		newHookTestProv("default", []string{}, nil),
+		newHookTestProv("cli", []string{"default"}, nil),
+		newHookTestProv("yaml", []string{"cli"}, nil),
+	}
+	for _, prov := range provs {
+		prov := prov
+		prov.tearDown = func() error {
+			log = append(log, prov.name)
+			return fmt.Errorf("%s is stuck", prov.name)
+		}
+		repo.RegisterProvider(prov)
+	}
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+
+	err := repo.TearDown()
+	merr, isMulti := err.(*MultiError)
+	if !isMulti || len(merr.Errors) != 3 {
+		t.Fatalf("Expected a MultiError with 3 errors, got: %#v", err)
+	}
+	if want := []string{"yaml", "cli", "default"}; !reflect.DeepEqual(log, want) {
+		t.Fatalf("Unexpected tear down order: got: %v, want: %v", log, want)
+	}
+}
+
+func TestSetUpRollbackKeys(t *testing.T) {
+	repo := NewRepository()
+	if _, err := NewDefaultProviderWithDefaults(repo, 0, map[string]Value{"a": 1}); err != nil {
+		t.Fatalf("Failed to initialize a new default provider: %s", err)
+	}
+	var broken *namedTestProv
+	broken = newHookTestProv("broken", []string{"default"}, func() error {
+		repo.RegisterKey(NewKey("b"), broken)
+		return fmt.Errorf("broken is broken")
+	})
+	repo.RegisterProvider(broken)
+
+	if err := repo.SetUp(); err == nil {
+		t.Fatalf("Expected the set up to fail")
+	}
+	for _, k := range []string{"a", "b"} {
+		if v, ok := repo.Get(NewKey(k)); ok {
+			t.Fatalf("Expected key %q to be removed on rollback, got: %#v", k, v)
+		}
+	}
+	if ph := repo.Health().Providers["default"]; ph.Healthy() {
+		t.Fatalf("Expected the rolled back provider to be reported unhealthy: %#v", ph)
+	}
+}
+
+// ctxTestProv implements the context-aware provider interface.
+type ctxTestProv struct {
+	*TestProv
+	setUpCtx chan context.Context
+	block    chan struct{}
+}
+
+var _ ContextProvider = (*ctxTestProv)(nil)
+
+func (ctp *ctxTestProv) SetUpContext(ctx context.Context, repo *Repository) error {
+	ctp.setUpCtx <- ctx
+	return ctp.SetUp(repo)
+}
+
+func (ctp *ctxTestProv) GetContext(ctx context.Context, key Key) (*KeyValue, bool) {
+	select {
+	case <-ctp.block:
+		return ctp.Get(key)
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+func TestSetUpContextProvider(t *testing.T) {
+	repo := NewRepositoryWithOptions(&RepositoryOptions{SetUpTimeout: time.Second})
+	prov := &ctxTestProv{
+		TestProv: NewTestProv(42, 10),
+		setUpCtx: make(chan context.Context, 1),
+		block:    make(chan struct{}),
+	}
+	repo.RegisterProvider(prov)
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+	if !prov.isSetUp {
+		t.Fatalf("Expected the provider to be set up")
+	}
+	if _, ok := (<-prov.setUpCtx).Deadline(); !ok {
+		t.Fatalf("Expected SetUpContext to receive a context with a deadline")
+	}
+	repo.RegisterKey(NewKey("foo"), prov)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if v, ok := repo.GetContext(ctx, NewKey("foo")); ok {
+		t.Fatalf("Expected GetContext to give up, got: %#v", v)
+	}
+
+	close(prov.block)
+	v, ok := repo.GetContext(context.Background(), NewKey("foo"))
+	if !ok || v != 42 {
+		t.Fatalf("Unexpected value: got: %#v, want: %#v", v, 42)
+	}
+}
+
+func TestGetNotReadyProvider(t *testing.T) {
+	repo := NewRepository()
+	prov, err := NewEnvProvider(repo, 10)
+	if err != nil {
+		t.Fatalf("Failed to initialize a new env provider: %s", err)
+	}
+	// The provider is never set up (e.g. abandoned on a set up timeout)
+	repo.RegisterKey(NewKey("foo"), prov)
+
+	done := make(chan bool, 1)
+	go func() {
+		_, ok := repo.Get(NewKey("foo"))
+		done <- ok
+	}()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Fatalf("Expected no value from a provider which is not ready")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("repo.Get() is blocked by a provider which is not ready")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, ok := repo.GetContext(ctx, NewKey("foo")); ok {
+		t.Fatalf("Expected no value from a provider which is not ready")
+	}
+}
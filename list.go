@@ -0,0 +1,78 @@
+package config
+
+import (
+	"strconv"
+)
+
+// listIndex returns the list index the key fragment stands for. A list index
+// is a non-negative decimal int in the canonical form: 0, 1, 42, but not 01.
+func listIndex(k string) (int, bool) {
+	ix, err := strconv.Atoi(k)
+	if err != nil || ix < 0 || strconv.Itoa(ix) != k {
+		return 0, false
+	}
+	return ix, true
+}
+
+// assemble returns the sub-key values as a list if the sub-keys are list
+// indices 0 to n-1 and as a map otherwise. A map keyed by numbers (e.g. HTTP
+// status codes) or a list with gaps (e.g. list.0 and list.5) is kept as is:
+// the indices are never renumbered.
+func assemble(res map[string]Value) Value {
+	if len(res) == 0 {
+		return res
+	}
+	list := make([]Value, len(res))
+	for k, v := range res {
+		ix, ok := listIndex(k)
+		if !ok || ix >= len(list) {
+			return res
+		}
+		list[ix] = v
+	}
+	return list
+}
+
+// preferLeaf reports whether the node value is served by the node providers
+// rather than assembled from the sub-keys. The node providers win unless the
+// sub-keys are list indices: a list might be served as a whole by a provider
+// (e.g. a default `links` value) and as a set of items by another one (e.g. a
+// yaml list flattened to `links.0`, `links.1`). The highest weight provider
+// wins in this case.
+func (n *node) preferLeaf(repo *Repository, key Key) bool {
+	if len(n.providers) == 0 {
+		return false
+	}
+	if len(n.children) == 0 {
+		return true
+	}
+	for k := range n.children {
+		if _, ok := listIndex(k); !ok {
+			return true
+		}
+	}
+	leaf, ok := maxWeight(repo.keyProviders(key, n.providers))
+	if !ok {
+		return false
+	}
+	seen := make(map[Provider]bool)
+	var items []Provider
+	for _, ch := range n.children {
+		items = ch.subtreeProviders(seen, items)
+	}
+	top, ok := maxWeight(items)
+	return !ok || leaf >= top
+}
+
+func maxWeight(provs []Provider) (int, bool) {
+	if len(provs) == 0 {
+		return 0, false
+	}
+	res := provs[0].Weight()
+	for _, prov := range provs[1:] {
+		if w := prov.Weight(); w > res {
+			res = w
+		}
+	}
+	return res, true
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name string
+		in   map[string]Value
+		want Value
+	}{
+		{"Empty map", map[string]Value{}, map[string]Value{}},
+		{"Indices", map[string]Value{"1": "b", "0": "a", "2": "c"}, []Value{"a", "b", "c"}},
+		{"Sparse indices", map[string]Value{"0": "a", "5": "b"}, map[string]Value{"0": "a", "5": "b"}},
+		{"Numeric keys", map[string]Value{"404": "a", "500": "b"}, map[string]Value{"404": "a", "500": "b"}},
+		{"Mixed keys", map[string]Value{"0": "a", "foo": "b"}, map[string]Value{"0": "a", "foo": "b"}},
+		{"Non-canonical index", map[string]Value{"01": "a"}, map[string]Value{"01": "a"}},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := assemble(testCase.in); !reflect.DeepEqual(got, testCase.want) {
+				t.Fatalf("Unexpected value: got: %#v, want: %#v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestIndexedListKeys(t *testing.T) {
+	src := []byte("pipeline:\n  links:\n    - name: a\n      port: 1\n    - name: b\n      port: 2\n  tags: []\n")
+
+	// Redefining the original value
+	oldReadRaw := readRaw
+	defer func() { readRaw = oldReadRaw }()
+	readRaw = func(source string) (map[interface{}]interface{}, error) {
+		out := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(src, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+	oldEnvVars := envVars
+	defer func() { envVars = oldEnvVars }()
+	envVars = func() []string {
+		return []string{"CONFIG_PIPELINE_LINKS_1_PORT=3", "CONFIG_PIPELINE_LINKS_2_NAME=c"}
+	}
+
+	repo := NewRepository()
+	if err := repo.DefineSchema(map[string]Schema{
+		"pipeline": map[string]Schema{
+			"links": map[string]Schema{
+				"*": map[string]Schema{
+					"port": ToInt,
+				},
+			},
+		},
+	}); err != nil {
+		t.Fatalf("Failed to define the schema: %s", err)
+	}
+	if _, err := NewYamlProviderFromSource(repo, 10, &YamlProviderOptions{}, "dummy.dummy"); err != nil {
+		t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+	}
+	if _, err := NewEnvProvider(repo, 20); err != nil {
+		t.Fatalf("Failed to initialize a new env provider: %s", err)
+	}
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+
+	want := []Value{
+		map[string]Value{"name": "a", "port": 1},
+		map[string]Value{"name": "b", "port": 3},
+		map[string]Value{"name": "c"},
+	}
+	if got, ok := repo.Get(NewKey("pipeline.links")); !ok || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected list value: got: %#v, want: %#v", got, want)
+	}
+	if got, ok := repo.Get(NewKey("pipeline.links.1.port")); !ok || got != 3 {
+		t.Fatalf("Unexpected list item value: got: %#v", got)
+	}
+	if got, ok := repo.Get(NewKey("pipeline.tags")); !ok || !reflect.DeepEqual(got, []Value{}) {
+		t.Fatalf("Expected an empty list to be kept as a leaf: got: %#v", got)
+	}
+	if got, ok := repo.Snapshot().Get(NewKey("pipeline.links")); !ok || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected snapshot list value: got: %#v, want: %#v", got, want)
+	}
+}
+
+func TestNumericKeys(t *testing.T) {
+	repo := NewRepository()
+	repo.RegisterKey(NewKey("codes.404"), newNamedTestProv("404", "not found", 10))
+	repo.RegisterKey(NewKey("codes.500"), newNamedTestProv("500", "internal error", 10))
+	repo.RegisterKey(NewKey("servers.0"), newNamedTestProv("server-a", "a", 10))
+	repo.RegisterKey(NewKey("servers.1"), newNamedTestProv("server-b", "b", 10))
+
+	want := map[string]Value{"404": "not found", "500": "internal error"}
+	if got, ok := repo.Get(NewKey("codes")); !ok || !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected numeric keys value: got: %#v, want: %#v", got, want)
+	}
+	if got, ok := repo.Get(NewKey("servers")); !ok || !reflect.DeepEqual(got, []Value{"a", "b"}) {
+		t.Fatalf("Unexpected list value: got: %#v", got)
+	}
+
+	// An item out of the list range is not renumbered
+	repo.RegisterKey(NewKey("servers.5"), newNamedTestProv("override", "f", 20))
+	wantServers := map[string]Value{"0": "a", "1": "b", "5": "f"}
+	if got, ok := repo.Get(NewKey("servers")); !ok || !reflect.DeepEqual(got, wantServers) {
+		t.Fatalf("Unexpected sparse list value: got: %#v, want: %#v", got, wantServers)
+	}
+}
+
+func TestListLeafOverride(t *testing.T) {
+	src := []byte("links: [y1, y2]\n")
+
+	// Redefining the original value
+	oldReadRaw := readRaw
+	defer func() { readRaw = oldReadRaw }()
+	readRaw = func(source string) (map[interface{}]interface{}, error) {
+		out := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(src, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	tests := []struct {
+		name          string
+		defaultWeight int
+		yamlWeight    int
+		want          Value
+	}{
+		{"Yaml list wins", 0, 10, []Value{"y1", "y2"}},
+		{"Default list wins", 20, 10, []Value{"d1"}},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := NewRepository()
+			if _, err := NewDefaultProviderWithDefaults(repo, testCase.defaultWeight, map[string]Value{
+				"links": []Value{"d1"},
+			}); err != nil {
+				t.Fatalf("Failed to initialize a new default provider: %s", err)
+			}
+			if _, err := NewYamlProviderFromSource(repo, testCase.yamlWeight, &YamlProviderOptions{}, "dummy.dummy"); err != nil {
+				t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+			}
+			if err := repo.SetUp(); err != nil {
+				t.Fatalf("Failed to set up the repo: %s", err)
+			}
+			if got, ok := repo.Get(NewKey("links")); !ok || !reflect.DeepEqual(got, testCase.want) {
+				t.Fatalf("Unexpected list value: got: %#v, want: %#v", got, testCase.want)
+			}
+			if got, ok := repo.Snapshot().Get(NewKey("links")); !ok || !reflect.DeepEqual(got, testCase.want) {
+				t.Fatalf("Unexpected snapshot list value: got: %#v, want: %#v", got, testCase.want)
+			}
+		})
+	}
+}
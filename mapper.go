@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"sort"
 )
 
 // Mapper is a generic interface for mapping actors. These co-exist hand-by-hand
@@ -18,6 +19,18 @@ type Mapper interface {
 type MapperNode struct {
 	Mpr      Mapper
 	Children map[string]*MapperNode
+	// Secret indicates the node values (including all sub-keys) are
+	// sensitive and must be redacted.
+	Secret bool
+	// Descr is a human-readable description of the key.
+	Descr string
+	// Merge is the strategy combining the values served by multiple
+	// providers for the key.
+	Merge MergeStrategy
+	// Pin and Exclude restrict the providers allowed to serve the node
+	// values (including all sub-keys).
+	Pin     []string
+	Exclude []string
 }
 
 // NewMapperNode is the constructor for MapperNode.
@@ -45,22 +58,47 @@ func (mn *MapperNode) Insert(key Key, mpr Mapper) *MapperNode {
 	var ptr *MapperNode
 	// Non-empty key check prevents users from accessing the root node
 	if len(key) > 0 {
-		ptr = mn
-		for _, k := range key {
-			if ptr.Children == nil {
-				ptr.Children = make(map[string]*MapperNode)
-			}
-			if _, ok := ptr.Children[k]; !ok {
-				ptr.Children[k] = NewMapperNode()
-			}
-			ptr = ptr.Children[k]
-		}
+		ptr = mn.findOrCreate(key)
 		ptr.Mpr = mpr
 	}
 
 	return ptr
 }
 
+func (mn *MapperNode) findOrCreate(key Key) *MapperNode {
+	ptr := mn
+	for _, k := range key {
+		if ptr.Children == nil {
+			ptr.Children = make(map[string]*MapperNode)
+		}
+		if _, ok := ptr.Children[k]; !ok {
+			ptr.Children[k] = NewMapperNode()
+		}
+		ptr = ptr.Children[k]
+	}
+	return ptr
+}
+
+// clone returns a deep copy of the trie structure. Mappers are shared
+// between the copies.
+func (mn *MapperNode) clone() *MapperNode {
+	cp := &MapperNode{
+		Mpr:     mn.Mpr,
+		Secret:  mn.Secret,
+		Descr:   mn.Descr,
+		Merge:   mn.Merge,
+		Pin:     mn.Pin,
+		Exclude: mn.Exclude,
+	}
+	if mn.Children != nil {
+		cp.Children = make(map[string]*MapperNode, len(mn.Children))
+		for k, ch := range mn.Children {
+			cp.Children[k] = ch.clone()
+		}
+	}
+	return cp
+}
+
 // Find performs a lookup of a relevant MapperNode in the trie structure by
 // following the provided Key path. If the needle node could not be found,
 // returns nil.
@@ -79,6 +117,45 @@ func (mn *MapperNode) Find(key Key) *MapperNode {
 	return nil
 }
 
+// Keys returns the keys declared by the schema: the nodes holding a mapper,
+// a description, a merge strategy or provider rules and the leaf nodes.
+// Wildcard fragments are returned as is. The keys are sorted.
+func (mn *MapperNode) Keys() []Key {
+	res := make([]Key, 0)
+	mn.collectKeys(nil, &res)
+	sort.Slice(res, func(a, b int) bool {
+		return res[a].String() < res[b].String()
+	})
+	return res
+}
+
+func (mn *MapperNode) collectKeys(key Key, res *[]Key) {
+	if len(key) > 0 && (mn.Mpr != nil || len(mn.Descr) > 0 || mn.Merge != MergeReplace ||
+		len(mn.Pin) > 0 || len(mn.Exclude) > 0 || len(mn.Children) == 0) {
+		*res = append(*res, key)
+	}
+	for k, ch := range mn.Children {
+		ch.collectKeys(key.child(k), res)
+	}
+}
+
+// IsSecret returns true if the key or any of it's parent keys has been marked
+// as secret. Wildcards are respected the same way as in `Find()`.
+func (mn *MapperNode) IsSecret(key Key) bool {
+	if mn.Secret {
+		return true
+	}
+	if len(key) == 0 {
+		return false
+	}
+	for _, nextK := range []string{key[0], "*"} {
+		if next, ok := mn.Children[nextK]; ok && next.IsSecret(key[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
 // DefineSchema is the primary way to bulk-register mappers in a MapperNode.
 // Schema is a very flexible structure. See Schema docs for more details.
 // If Schema is defined as a map[string]Schema, MapperNode will explicitly look
@@ -103,6 +180,12 @@ func (mn *MapperNode) Find(key Key) *MapperNode {
 // __self__ might be set to nil in the schema definition in order to emphasise
 // an absence of the mapper for the parental key. It's fully equivalent to
 // no-definition for key __self__.
+//
+// A schema wrapped with Secret() is defined as usual and the corresponding
+// node is marked as secret. A schema wrapped with Describe() is defined as
+// usual and the description is attached to the corresponding node. The same
+// applies to the merge strategy set by Merge() and the provider rules set by
+// Pin() and Exclude().
 func (mn *MapperNode) DefineSchema(s Schema) error {
 	return mn.doDefineSchema(NewKey(""), s)
 }
@@ -110,6 +193,28 @@ func (mn *MapperNode) DefineSchema(s Schema) error {
 func (mn *MapperNode) doDefineSchema(key Key, schema Schema) error {
 	if schema == nil {
 		return nil
+	} else if ss, ok := schema.(*secretSchema); ok {
+		if err := mn.doDefineSchema(key, ss.schema); err != nil {
+			return err
+		}
+		mn.findOrCreate(key).Secret = true
+	} else if ds, ok := schema.(*describedSchema); ok {
+		if err := mn.doDefineSchema(key, ds.schema); err != nil {
+			return err
+		}
+		mn.findOrCreate(key).Descr = ds.descr
+	} else if ms, ok := schema.(*mergeSchema); ok {
+		if err := mn.doDefineSchema(key, ms.schema); err != nil {
+			return err
+		}
+		mn.findOrCreate(key).Merge = ms.strategy
+	} else if rs, ok := schema.(*ruleSchema); ok {
+		if err := mn.doDefineSchema(key, rs.schema); err != nil {
+			return err
+		}
+		ptr := mn.findOrCreate(key)
+		ptr.Pin = append(ptr.Pin, rs.pin...)
+		ptr.Exclude = append(ptr.Exclude, rs.exclude...)
 	} else if mpr, ok := schema.(Mapper); ok {
 		mn.Insert(key, mpr)
 	} else if cnv, ok := schema.(Converter); ok {
@@ -164,6 +269,11 @@ func NewConvMapper(conv Converter) *ConvMapper {
 	return &ConvMapper{conv}
 }
 
+// TypeName returns the type name of the wrapped converter. Empty if unknown.
+func (cm *ConvMapper) TypeName() string {
+	return typeName(cm.conv)
+}
+
 // Map returns a key-value pair if the Converter recognised the value.
 // Returns nil, err otherwise.
 func (cm *ConvMapper) Map(kv *KeyValue) (*KeyValue, error) {
@@ -437,3 +437,39 @@ func TestMap(t *testing.T) {
 		})
 	}
 }
+
+func TestMapperNodeKeys(t *testing.T) {
+	conv := func(kv *KeyValue) (*KeyValue, error) { return kv, nil }
+	mn := NewMapperNode()
+	if err := mn.DefineSchema(map[string]Schema{
+		"system": map[string]Schema{
+			"__self__": NewTestMapper(conv),
+			"maxprocs": ToInt,
+			"admin": map[string]Schema{
+				"enabled": ToBool,
+			},
+		},
+		"plugins": map[string]Schema{
+			"*": map[string]Schema{
+				"path": ToStr,
+			},
+		},
+		"tokens": Secret(nil),
+	}); err != nil {
+		t.Fatalf("Failed to define the schema: %s", err)
+	}
+	got := make([]string, 0)
+	for _, k := range mn.Keys() {
+		got = append(got, k.String())
+	}
+	want := []string{
+		"plugins.*.path",
+		"system",
+		"system.admin.enabled",
+		"system.maxprocs",
+		"tokens",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected keys: got: %v, want: %v", got, want)
+	}
+}
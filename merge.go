@@ -0,0 +1,313 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"sort"
+)
+
+// MergeStrategy defines how the values served by multiple providers for the
+// same key are combined (see Merge).
+type MergeStrategy int
+
+const (
+	// MergeReplace is the default strategy: the value served by the provider
+	// with the highest weight wins.
+	MergeReplace MergeStrategy = iota
+	// MergeAppend concatenates the lists served by all the providers, the
+	// lowest weight first. A non-list value is treated as a single-item
+	// list.
+	MergeAppend
+	// MergeUnion is the same as MergeAppend, but the duplicate items are
+	// dropped: the first occurrence is kept.
+	MergeUnion
+)
+
+func (s MergeStrategy) String() string {
+	switch s {
+	case MergeReplace:
+		return "replace"
+	case MergeAppend:
+		return "append"
+	case MergeUnion:
+		return "union"
+	}
+	return "unknown"
+}
+
+// mergeSchema is a schema marker produced by Merge().
+type mergeSchema struct {
+	schema   Schema
+	strategy MergeStrategy
+}
+
+// Merge sets the merge strategy for a schema node. The wrapped schema is
+// defined as usual. Maps served by multiple providers are merged key-wise:
+// the strategy is applied to the lists under the same key, other values are
+// replaced by the higher weight ones.
+// The merged value is passed to the node mapper.
+//
+// Example:
+// schema := map[string]Schema{"plugins": Merge(nil, MergeUnion)}
+// With plugins: [a, b] served by the default provider and plugins: [b, c]
+// served by the yaml provider, plugins resolves to [a b c].
+func Merge(s Schema, strategy MergeStrategy) Schema {
+	return &mergeSchema{schema: s, strategy: strategy}
+}
+
+// MergeStrategy returns the merge strategy declared for the key. Wildcards are
+// respected the same way as in `Find()`.
+func (mn *MapperNode) MergeStrategy(key Key) MergeStrategy {
+	if ptr := mn.Find(key); ptr != nil {
+		return ptr.Merge
+	}
+	return MergeReplace
+}
+
+// mergeSource is a value served by a single provider. The secret flag
+// indicates whether the value (or any of its sub-keys) is a secret.
+type mergeSource struct {
+	provider Provider
+	value    Value
+	secret   bool
+}
+
+// mergeSources returns the node values per provider, the lowest weight
+// first. A sub-tree value is assembled from the values served by the
+// provider only. If redact is set, the secret leaf values are wrapped in
+// SecretValue and the sub-key values are left unmapped.
+func (n *node) mergeSources(ctx context.Context, repo *Repository, key Key, redact bool) ([]mergeSource, error) {
+	provs := n.subtreeProviders(make(map[Provider]bool), nil)
+	sort.SliceStable(provs, func(a, b int) bool {
+		return provs[a].Weight() < provs[b].Weight()
+	})
+	res := make([]mergeSource, 0, len(provs))
+	for _, prov := range provs {
+		v, secret, ok, err := n.providerValue(ctx, repo, prov, key, redact)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, mergeSource{provider: prov, value: v, secret: secret})
+		}
+	}
+	return res, nil
+}
+
+func (n *node) subtreeProviders(seen map[Provider]bool, res []Provider) []Provider {
+	for _, prov := range n.providers {
+		if !seen[prov] {
+			seen[prov] = true
+			res = append(res, prov)
+		}
+	}
+	for _, ch := range n.children {
+		res = ch.subtreeProviders(seen, res)
+	}
+	return res
+}
+
+// providerValue returns the unmapped node value served by the provider. A
+// leaf value is returned as is (secrets are unwrapped unless redact is set).
+// A sub-tree value is assembled from the mapped sub-key values the same way
+// getAll does. A provider might serve a key as a leaf while another one
+// serves it as a sub-tree (e.g. a list and a set of indexed keys). The secret
+// flag indicates whether the value contains any secret.
+func (n *node) providerValue(ctx context.Context, repo *Repository, prov Provider, key Key, redact bool) (Value, bool, bool, error) {
+	for _, p := range n.providers {
+		if p != prov {
+			continue
+		}
+		if !repo.allowsProvider(key, prov) {
+			return nil, false, false, nil
+		}
+		kv, ok := providerGet(ctx, prov, key)
+		if !ok {
+			return nil, false, false, nil
+		}
+		v, wrapped := unwrapSecret(kv.Value)
+		secret := wrapped || repo.isSecret(key, prov)
+		if secret && redact {
+			v = NewSecretValue(v)
+		}
+		return v, secret, true, nil
+	}
+	res := make(map[string]Value)
+	secret := false
+	for k, ch := range n.children {
+		chKey := key.child(k)
+		v, chSecret, ok, err := ch.providerValue(ctx, repo, prov, chKey, redact)
+		if err != nil {
+			return nil, false, false, err
+		}
+		if !ok {
+			continue
+		}
+		secret = secret || chSecret
+		if redact {
+			res[k] = v
+			continue
+		}
+		mkv, err := repo.doMap(&KeyValue{Key: chKey, Value: v})
+		if err != nil {
+			return nil, false, false, err
+		}
+		res[k] = mkv.Value
+	}
+	if len(res) == 0 {
+		return nil, false, false, nil
+	}
+	return assemble(res), secret, true, nil
+}
+
+// mergeStrategy returns the merge strategy declared for the key.
+func (repo *Repository) mergeStrategy(key Key) MergeStrategy {
+	if len(key) == 0 {
+		return MergeReplace
+	}
+	return repo.loadMappers().MergeStrategy(key)
+}
+
+// resolveMerged combines the node values served by all the providers
+// according to the strategy and maps the result. The first bool flag
+// indicates whether any of the merged values is a secret (a secret provider
+// value or a secret key), the second one whether any provider served a value.
+func (repo *Repository) resolveMerged(ctx context.Context, n *node, key Key, strategy MergeStrategy) (*KeyValue, bool, bool, error) {
+	sources, err := n.mergeSources(ctx, repo, key, false)
+	if err == nil && len(sources) == 0 {
+		return nil, false, false, nil
+	}
+	var mkv *KeyValue
+	if err == nil {
+		mkv, err = repo.doMap(&KeyValue{Key: key, Value: mergeAll(strategy, sources)})
+	}
+	if err != nil {
+		repo.Emit(Event{Type: EventConversionFailed, Key: key, Err: err})
+		return nil, false, false, err
+	}
+	secret := repo.loadMappers().IsSecret(key)
+	for _, src := range sources {
+		secret = secret || src.secret
+	}
+	return mkv, secret, true, nil
+}
+
+// mergeAll folds the source values, the lowest weight first.
+func mergeAll(strategy MergeStrategy, sources []mergeSource) Value {
+	var res Value
+	for ix, src := range sources {
+		if ix == 0 {
+			res = src.value
+			continue
+		}
+		res = mergeValues(strategy, res, src.value)
+	}
+	if strategy == MergeUnion {
+		if list, ok := res.([]Value); ok {
+			res = dedupe(list)
+		}
+	}
+	return res
+}
+
+// mergeValues combines a lower weight value with a higher weight one. Maps
+// are merged key-wise: the lists under the same key are merged according to
+// the strategy, other values are replaced.
+func mergeValues(strategy MergeStrategy, lo, hi Value) Value {
+	lm, lok := lo.(map[string]Value)
+	hm, hok := hi.(map[string]Value)
+	if lok && hok {
+		res := make(map[string]Value, len(lm)+len(hm))
+		for k, v := range lm {
+			res[k] = v
+		}
+		for k, v := range hm {
+			if lv, ok := res[k]; ok && (isList(lv) || isList(v) || isMap(lv) && isMap(v)) {
+				v = mergeValues(strategy, lv, v)
+			}
+			res[k] = v
+		}
+		return res
+	}
+	if strategy == MergeReplace {
+		return hi
+	}
+	res := append(toList(lo), toList(hi)...)
+	if strategy == MergeUnion {
+		res = dedupe(res)
+	}
+	return res
+}
+
+func isList(v Value) bool {
+	return v != nil && reflect.ValueOf(v).Kind() == reflect.Slice
+}
+
+func isMap(v Value) bool {
+	_, ok := v.(map[string]Value)
+	return ok
+}
+
+// toList returns a copy of a slice value as []Value. A non-slice value is
+// converted to a single-item list.
+func toList(v Value) []Value {
+	if !isList(v) {
+		return []Value{v}
+	}
+	rv := reflect.ValueOf(v)
+	res := make([]Value, 0, rv.Len())
+	for ix := 0; ix < rv.Len(); ix++ {
+		res = append(res, rv.Index(ix).Interface())
+	}
+	return res
+}
+
+// dedupe drops the duplicate list items keeping the first occurrence.
+func dedupe(list []Value) []Value {
+	res := make([]Value, 0, len(list))
+	for _, v := range list {
+		dup := false
+		for _, seen := range res {
+			if reflect.DeepEqual(seen, v) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// explainMerge describes how the merged value of the node has been built:
+// the strategy, the values per provider and the resulting value. The values
+// are unmapped and every secret leaf value is redacted.
+func (n *node) explainMerge(repo *Repository, key Key, strategy MergeStrategy) map[string]interface{} {
+	sources, err := n.mergeSources(context.Background(), repo, key, true)
+	if err != nil {
+		return map[string]interface{}{"strategy": strategy.String(), "error": err.Error()}
+	}
+	secret := repo.loadMappers().IsSecret(key)
+	descr := make([]map[string]interface{}, 0, len(sources))
+	for _, src := range sources {
+		val := src.value
+		if secret {
+			val = NewSecretValue(val)
+		}
+		descr = append(descr, map[string]interface{}{
+			"provider_name":   src.provider.Name(),
+			"provider_weight": src.provider.Weight(),
+			"value":           val,
+		})
+	}
+	var merged Value = mergeAll(strategy, sources)
+	if secret {
+		merged = NewSecretValue(merged)
+	}
+	return map[string]interface{}{
+		"strategy": strategy.String(),
+		"sources":  descr,
+		"value":    merged,
+	}
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestMergeValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy MergeStrategy
+		lo, hi   Value
+		want     Value
+	}{
+		{"Replace", MergeReplace, []Value{"a"}, []Value{"b"}, []Value{"b"}},
+		{"Append", MergeAppend, []Value{"a", "b"}, []string{"b", "c"}, []Value{"a", "b", "b", "c"}},
+		{"Append scalars", MergeAppend, "a", "b", []Value{"a", "b"}},
+		{"Union", MergeUnion, []Value{"a", "b"}, []Value{"b", "c"}, []Value{"a", "b", "c"}},
+		{
+			"Maps",
+			MergeAppend,
+			map[string]Value{"list": []Value{1}, "a": 1, "b": 2},
+			map[string]Value{"list": []Value{2}, "b": 3, "c": 4},
+			map[string]Value{"list": []Value{1, 2}, "a": 1, "b": 3, "c": 4},
+		},
+		{
+			"Maps replace",
+			MergeReplace,
+			map[string]Value{"list": []Value{1}, "a": 1},
+			map[string]Value{"list": []Value{2}},
+			map[string]Value{"list": []Value{2}, "a": 1},
+		},
+	}
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			got := mergeValues(testCase.strategy, testCase.lo, testCase.hi)
+			if !reflect.DeepEqual(got, testCase.want) {
+				t.Fatalf("Unexpected merge result: got: %#v, want: %#v", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryMerge(t *testing.T) {
+	src := []byte("plugins: [b, c]\nlisteners: [udp]\nhooks: [x]\nlimits:\n  conns: 20\n  peers: [p2]\n")
+
+	// Redefining the original value
+	oldReadRaw := readRaw
+	defer func() { readRaw = oldReadRaw }()
+	readRaw = func(source string) (map[interface{}]interface{}, error) {
+		out := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(src, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	repo := NewRepository()
+	if err := repo.DefineSchema(map[string]Schema{
+		"plugins":   Merge(nil, MergeUnion),
+		"listeners": Merge(nil, MergeAppend),
+		"hooks":     nil,
+		"limits":    Merge(nil, MergeAppend),
+	}); err != nil {
+		t.Fatalf("Failed to define the schema: %s", err)
+	}
+	if _, err := NewDefaultProviderWithDefaults(repo, 0, map[string]Value{
+		"plugins":      []Value{"a", "b"},
+		"listeners":    []Value{"tcp"},
+		"hooks":        []Value{"y"},
+		"limits.conns": 10,
+		"limits.rps":   5,
+		"limits.peers": []Value{"p1"},
+	}); err != nil {
+		t.Fatalf("Failed to initialize a new default provider: %s", err)
+	}
+	if _, err := NewYamlProviderFromSource(repo, 10, &YamlProviderOptions{}, "dummy.dummy"); err != nil {
+		t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+	}
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+
+	want := map[string]Value{
+		"plugins":   []Value{"a", "b", "c"},
+		"listeners": []Value{"tcp", "udp"},
+		// No merge strategy: the yaml items override the default list
+		"hooks.0": "x",
+		"limits": map[string]Value{
+			"conns": 20,
+			"rps":   5,
+			"peers": []Value{"p1", "p2"},
+		},
+	}
+	for k, v := range want {
+		if got, ok := repo.Get(NewKey(k)); !ok || !reflect.DeepEqual(got, v) {
+			t.Fatalf("Unexpected value for key %q: got: %#v, want: %#v", k, got, v)
+		}
+	}
+
+	merge, ok := repo.Explain()["plugins"].(map[string]interface{})["__merge__"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected a merge breakdown in explain output: %#v", repo.Explain()["plugins"])
+	}
+	wantMerge := map[string]interface{}{
+		"strategy": "union",
+		"sources": []map[string]interface{}{
+			{"provider_name": "default", "provider_weight": 0, "value": []Value{"a", "b"}},
+			{"provider_name": "yaml", "provider_weight": 10, "value": []Value{"b", "c"}},
+		},
+		"value": []Value{"a", "b", "c"},
+	}
+	if !reflect.DeepEqual(merge, wantMerge) {
+		t.Fatalf("Unexpected merge breakdown: got: %#v, want: %#v", merge, wantMerge)
+	}
+}
+
+func TestMergeSecrets(t *testing.T) {
+	buf := &bytes.Buffer{}
+	repo := NewRepositoryWithOptions(&RepositoryOptions{
+		AuditSink: NewJSONLinesAuditSink(buf),
+	})
+	if err := repo.DefineSchema(map[string]Schema{
+		"tokens": Merge(nil, MergeAppend),
+		"db": Merge(map[string]Schema{
+			"user":     ToStr,
+			"password": Secret(ToStr),
+		}, MergeAppend),
+	}); err != nil {
+		t.Fatalf("Failed to define the schema: %s", err)
+	}
+	secret := &TestSecretProv{NewTestProv("s3cr3t", 20)}
+	repo.RegisterKey(NewKey("tokens"), newNamedTestProv("public", "pub", 10))
+	repo.RegisterKey(NewKey("tokens"), secret)
+	repo.RegisterKey(NewKey("db.password"), newNamedTestProv("pass", "hunter2", 10))
+	repo.RegisterKey(NewKey("db.user"), newNamedTestProv("user", "admin", 20))
+
+	// The lookups keep returning the real values
+	if got, ok := repo.Get(NewKey("tokens")); !ok || !reflect.DeepEqual(got, []Value{"pub", "s3cr3t"}) {
+		t.Fatalf("Unexpected lookup result: got: %#v, %t", got, ok)
+	}
+	if got, ok := repo.Get(NewKey("db.password")); !ok || got != "hunter2" {
+		t.Fatalf("Unexpected lookup result: got: %#v, %t", got, ok)
+	}
+
+	dump := repo.Dump()
+	if want := NewSecretValue([]Value{"pub", "s3cr3t"}); !reflect.DeepEqual(dump["tokens"], want) {
+		t.Fatalf("Unexpected dump value: got: %#v, want: %#v", dump["tokens"], want)
+	}
+
+	repo.ReportChange(secret, NewKey("tokens"))
+	if !strings.Contains(buf.String(), `"key":"tokens"`) {
+		t.Fatalf("Expected the change to be audited: %s", buf.String())
+	}
+
+	explain := fmt.Sprintf("%v", repo.Explain())
+	for name, out := range map[string]string{
+		"dump":    fmt.Sprintf("%v", dump),
+		"audit":   buf.String(),
+		"explain": explain,
+	} {
+		for _, s := range []string{"s3cr3t", "hunter2"} {
+			if strings.Contains(out, s) {
+				t.Fatalf("Secret %q leaked into the %s output: %s", s, name, out)
+			}
+		}
+	}
+	if !strings.Contains(explain, "admin") {
+		t.Fatalf("repo.Explain() is expected to reveal non-secret values: %s", explain)
+	}
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"time"
+)
+
+// Names of the metrics reported by the repository.
+const (
+	// MetricGetTotal counts Get calls, labeled by the key prefix.
+	MetricGetTotal = "config_get_total"
+	// MetricCacheHitsTotal counts lookups served from the cache, labeled by
+	// the key prefix.
+	MetricCacheHitsTotal = "config_cache_hits_total"
+	// MetricMapperDuration is a histogram of the schema mapping latency in
+	// seconds, labeled by the key prefix.
+	MetricMapperDuration = "config_mapper_duration_seconds"
+	// MetricConversionFailuresTotal counts mapping failures, labeled by the
+	// complete key.
+	MetricConversionFailuresTotal = "config_conversion_failures_total"
+	// MetricReloadsTotal counts config source reloads, labeled by the
+	// provider name and the status (success or failure).
+	MetricReloadsTotal = "config_reloads_total"
+	// MetricReloadDuration is a histogram of the config source reload
+	// duration in seconds, labeled by the provider name.
+	MetricReloadDuration = "config_reload_duration_seconds"
+	// MetricLastReloadTimestamp is a gauge holding the unix time of the last
+	// successful config source reload, labeled by the provider name.
+	MetricLastReloadTimestamp = "config_last_reload_timestamp_seconds"
+)
+
+// Label names used by the repository metrics.
+const (
+	LabelPrefix   = "prefix"
+	LabelKey      = "key"
+	LabelProvider = "provider"
+	LabelStatus   = "status"
+)
+
+// Metrics is a sink for the repository instrumentation (see
+// RepositoryOptions.Metrics). The methods are called synchronously from the
+// lookup path: an implementation must be thread safe and fast.
+type Metrics interface {
+	// IncCounter increments the counter by 1.
+	IncCounter(name string, labels map[string]string)
+	// Observe records a value in the histogram.
+	Observe(name string, labels map[string]string, value float64)
+	// SetGauge sets the gauge to the value.
+	SetGauge(name string, labels map[string]string, value float64)
+}
+
+// metricsPrefix returns the key prefix used as a metric label: the first
+// RepositoryOptions.MetricsPrefixDepth key fragments (1 by default). It
+// keeps the number of the distinct label values reasonable.
+func (repo *Repository) metricsPrefix(key Key) string {
+	depth := repo.options.MetricsPrefixDepth
+	if depth <= 0 {
+		depth = 1
+	}
+	if len(key) > depth {
+		key = key[:depth]
+	}
+	return key.String()
+}
+
+// recordEvent converts the lifecycle events into metrics.
+func (repo *Repository) recordEvent(e Event) {
+	metrics := repo.options.Metrics
+	switch e.Type {
+	case EventConversionFailed:
+		metrics.IncCounter(MetricConversionFailuresTotal, map[string]string{LabelKey: e.Key.String()})
+	case EventReloadSucceeded, EventReloadFailed:
+		status := "success"
+		if e.Type == EventReloadFailed {
+			status = "failure"
+		}
+		metrics.IncCounter(MetricReloadsTotal, map[string]string{LabelProvider: e.Provider, LabelStatus: status})
+		if e.Duration > 0 {
+			metrics.Observe(MetricReloadDuration, map[string]string{LabelProvider: e.Provider}, e.Duration.Seconds())
+		}
+		if e.Type == EventReloadSucceeded {
+			metrics.SetGauge(MetricLastReloadTimestamp, map[string]string{LabelProvider: e.Provider}, float64(e.Time.UnixNano())/1e9)
+		}
+	}
+}
+
+// timeMapping reports the mapping latency for the key.
+func (repo *Repository) timeMapping(key Key, start time.Time) {
+	repo.options.Metrics.Observe(MetricMapperDuration, map[string]string{LabelPrefix: repo.metricsPrefix(key)}, time.Since(start).Seconds())
+}
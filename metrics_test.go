@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// recordingMetrics keeps the counters and the number of histogram
+// observations and gauge updates per series.
+type recordingMetrics struct {
+	mx     sync.Mutex
+	counts map[string]int
+}
+
+func newRecordingMetrics() *recordingMetrics {
+	return &recordingMetrics{counts: make(map[string]int)}
+}
+
+func (rm *recordingMetrics) record(name string, labels map[string]string) {
+	rm.mx.Lock()
+	defer rm.mx.Unlock()
+	rm.counts[name+"{"+formatLabels(labels)+"}"]++
+}
+
+func (rm *recordingMetrics) IncCounter(name string, labels map[string]string) {
+	rm.record(name, labels)
+}
+
+func (rm *recordingMetrics) Observe(name string, labels map[string]string, _ float64) {
+	rm.record(name, labels)
+}
+
+func (rm *recordingMetrics) SetGauge(name string, labels map[string]string, _ float64) {
+	rm.record(name, labels)
+}
+
+func TestRepositoryMetrics(t *testing.T) {
+	metrics := newRecordingMetrics()
+	repo := NewRepositoryWithOptions(&RepositoryOptions{Cache: true, Metrics: metrics})
+	if err := repo.DefineSchema(map[string]Schema{
+		"system": map[string]Schema{
+			"maxprocs": ToInt,
+		},
+		"broken": NewTestMapper(func(kv *KeyValue) (*KeyValue, error) {
+			return nil, fmt.Errorf("broken")
+		}),
+	}); err != nil {
+		t.Fatalf("Failed to define the schema: %s", err)
+	}
+	repo.RegisterKey(NewKey("system.maxprocs"), NewTestProv("4", 10))
+	repo.RegisterKey(NewKey("broken"), NewTestProv("value", 10))
+
+	for i := 0; i < 3; i++ {
+		if v, ok := repo.Get(NewKey("system.maxprocs")); !ok || v != 4 {
+			t.Fatalf("Unexpected value: %#v", v)
+		}
+	}
+	func() {
+		defer func() { recover() }()
+		repo.Get(NewKey("broken"))
+	}()
+
+	want := map[string]int{
+		`config_get_total{prefix="system"}`:               3,
+		`config_cache_hits_total{prefix="system"}`:        2,
+		`config_mapper_duration_seconds{prefix="system"}`: 1,
+		`config_get_total{prefix="broken"}`:               1,
+		`config_mapper_duration_seconds{prefix="broken"}`: 1,
+		`config_conversion_failures_total{key="broken"}`:  1,
+	}
+	if !reflect.DeepEqual(metrics.counts, want) {
+		t.Fatalf("Unexpected metrics: got: %v, want: %v", metrics.counts, want)
+	}
+}
+
+func TestMetricsPrefixDepth(t *testing.T) {
+	repo := NewRepositoryWithOptions(&RepositoryOptions{MetricsPrefixDepth: 2})
+	tests := map[string]string{
+		"system":               "system",
+		"system.maxprocs":      "system.maxprocs",
+		"system.admin.enabled": "system.admin",
+	}
+	for key, want := range tests {
+		if got := repo.metricsPrefix(NewKey(key)); got != want {
+			t.Fatalf("Unexpected prefix for key %q: got: %q, want: %q", key, got, want)
+		}
+	}
+}
+
+func TestYamlProviderReloadMetrics(t *testing.T) {
+	src := []byte("system:\n  maxprocs: 4\n")
+
+	// Redefining the original value
+	oldReadRaw := readRaw
+	defer func() { readRaw = oldReadRaw }()
+	readRaw = func(source string) (map[interface{}]interface{}, error) {
+		out := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(src, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	metrics := newRecordingMetrics()
+	repo := NewRepositoryWithOptions(&RepositoryOptions{Metrics: metrics})
+	prov, err := NewYamlProviderFromSource(repo, 0, &YamlProviderOptions{}, "dummy.dummy")
+	if err != nil {
+		t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+	}
+	if err := prov.SetUp(repo); err != nil {
+		t.Fatalf("Failed to set up yaml provider: %s", err)
+	}
+	prov.reload()
+	src = []byte("system: [")
+	prov.reload()
+
+	got := make([]string, 0)
+	for k := range metrics.counts {
+		got = append(got, k)
+	}
+	sort.Strings(got)
+	want := []string{
+		`config_last_reload_timestamp_seconds{provider="yaml"}`,
+		`config_reload_duration_seconds{provider="yaml"}`,
+		`config_reloads_total{provider="yaml",status="failure"}`,
+		`config_reloads_total{provider="yaml",status="success"}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected metrics: got: %v, want: %v", got, want)
+	}
+	if n := metrics.counts[`config_reload_duration_seconds{provider="yaml"}`]; n != 2 {
+		t.Fatalf("Expected 2 reload duration observations, got: %d", n)
+	}
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// EventType is a type of a repository lifecycle event.
+type EventType int
+
+const (
+	// EventSetUp is emitted once a provider set up is complete. Err is set
+	// if the provider failed to set up.
+	EventSetUp EventType = iota + 1
+	// EventTearDown is emitted once a provider has been torn down. Err is
+	// set if the provider failed to tear down.
+	EventTearDown
+	// EventKeyRegistered is emitted on every key registration.
+	EventKeyRegistered
+	// EventReloadStarted is emitted by a dynamic provider before it re-reads
+	// the config source.
+	EventReloadStarted
+	// EventReloadSucceeded is emitted by a dynamic provider once the config
+	// source has been re-read.
+	EventReloadSucceeded
+	// EventReloadFailed is emitted by a dynamic provider if it failed to
+	// re-read or to keep watching the config source.
+	EventReloadFailed
+	// EventConversionFailed is emitted if a value served by a provider could
+	// not be mapped according to the schema.
+	EventConversionFailed
+	// EventAuditFailed is emitted if the audit sink failed to record an
+	// effective config change.
+	EventAuditFailed
+)
+
+var eventTypeNames = map[EventType]string{
+	EventSetUp:            "setup",
+	EventTearDown:         "teardown",
+	EventKeyRegistered:    "key_registered",
+	EventReloadStarted:    "reload_started",
+	EventReloadSucceeded:  "reload_succeeded",
+	EventReloadFailed:     "reload_failed",
+	EventConversionFailed: "conversion_failed",
+	EventAuditFailed:      "audit_failed",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", int(t))
+}
+
+// Event is a structured repository lifecycle event. Fields which are not
+// relevant for the event type are left blank.
+type Event struct {
+	Type     EventType
+	Provider string
+	Key      Key
+	Err      error
+	Time     time.Time
+	Duration time.Duration
+}
+
+// Failed reports whether the event describes a failure.
+func (e Event) Failed() bool {
+	return e.Err != nil || e.Type == EventReloadFailed || e.Type == EventConversionFailed || e.Type == EventAuditFailed
+}
+
+func (e Event) String() string {
+	chunks := []string{"event=" + e.Type.String()}
+	if len(e.Provider) > 0 {
+		chunks = append(chunks, "provider="+e.Provider)
+	}
+	if len(e.Key) > 0 {
+		chunks = append(chunks, "key="+e.Key.String())
+	}
+	if e.Duration > 0 {
+		chunks = append(chunks, "duration="+e.Duration.String())
+	}
+	if e.Err != nil {
+		chunks = append(chunks, fmt.Sprintf("error=%q", e.Err.Error()))
+	}
+	return strings.Join(chunks, " ")
+}
+
+// Observer receives the repository lifecycle events (see
+// RepositoryOptions.Observer). Observe is called synchronously: it should not
+// block and must not modify the repository.
+type Observer interface {
+	Observe(Event)
+}
+
+// ObserverFunc is an adapter allowing to use an ordinary function as an
+// Observer.
+type ObserverFunc func(Event)
+
+// Observe calls f(e).
+func (f ObserverFunc) Observe(e Event) { f(e) }
+
+// logObserver writes the events to a standard library logger.
+type logObserver struct {
+	logger *log.Logger
+}
+
+// NewLogObserver returns an Observer writing every event as a single line to
+// the logger. If the logger is nil, the events are written to stderr.
+func NewLogObserver(logger *log.Logger) Observer {
+	if logger == nil {
+		logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	return &logObserver{logger: logger}
+}
+
+func (lo *logObserver) Observe(e Event) {
+	lo.logger.Printf("config: %s", e)
+}
+
+// Emit passes the event to the repository observer (if defined). Reload and
+// conversion failure events are reflected in the repository metrics (if
+// defined). Providers use it to report their own events, e.g. config source
+// reloads. The event time is set to now unless defined.
+func (repo *Repository) Emit(e Event) {
+	observer, metrics := repo.options.Observer, repo.options.Metrics
+	if observer == nil && metrics == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if metrics != nil {
+		repo.recordEvent(e)
+	}
+	if observer != nil {
+		observer.Observe(e)
+	}
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+// eventLog collects the observed events.
+type eventLog struct {
+	mx     sync.Mutex
+	events []Event
+}
+
+func (el *eventLog) Observe(e Event) {
+	el.mx.Lock()
+	defer el.mx.Unlock()
+	el.events = append(el.events, e)
+}
+
+// summary returns a short description of every event of the listed types.
+func (el *eventLog) summary(types ...EventType) []string {
+	el.mx.Lock()
+	defer el.mx.Unlock()
+	res := make([]string, 0)
+	for _, e := range el.events {
+		for _, typ := range types {
+			if e.Type != typ {
+				continue
+			}
+			descr := e.Type.String() + ":" + e.Provider
+			if len(e.Key) > 0 {
+				descr += ":" + e.Key.String()
+			}
+			if e.Err != nil {
+				descr += ":" + e.Err.Error()
+			}
+			res = append(res, descr)
+		}
+	}
+	return res
+}
+
+func TestRepositoryObserver(t *testing.T) {
+	events := &eventLog{}
+	repo := NewRepositoryWithOptions(&RepositoryOptions{Observer: events})
+	if err := repo.DefineSchema(map[string]Schema{
+		"system": map[string]Schema{
+			"maxprocs": NewTestMapper(func(kv *KeyValue) (*KeyValue, error) {
+				return nil, fmt.Errorf("not a number")
+			}),
+		},
+	}); err != nil {
+		t.Fatalf("Failed to define the schema: %s", err)
+	}
+	if _, err := NewDefaultProviderWithDefaults(repo, 0, map[string]Value{"system.maxprocs": "four"}); err != nil {
+		t.Fatalf("Failed to initialize a new default provider: %s", err)
+	}
+	plugin := newHookTestProv("plugin", []string{"default"}, nil)
+	plugin.tearDown = func() error { return fmt.Errorf("plugin is stuck") }
+	repo.RegisterProvider(plugin)
+
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatalf("Expected the lookup to panic")
+			}
+		}()
+		repo.Get(NewKey("system.maxprocs"))
+	}()
+	if err := repo.TearDown(); err == nil {
+		t.Fatalf("Expected the tear down to fail")
+	}
+
+	got := events.summary(EventSetUp, EventKeyRegistered, EventConversionFailed, EventTearDown)
+	want := []string{
+		"key_registered:default:system.maxprocs",
+		"setup:default",
+		"setup:plugin",
+		"conversion_failed:default:system.maxprocs:not a number",
+		"teardown:plugin:plugin is stuck",
+		"teardown:default",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected events: got: %v, want: %v", got, want)
+	}
+	for _, e := range events.events {
+		if e.Time.IsZero() {
+			t.Fatalf("Expected the event time to be set: %#v", e)
+		}
+	}
+}
+
+func TestYamlProviderReloadEvents(t *testing.T) {
+	src := []byte("system:\n  maxprocs: 4\n")
+
+	// Redefining the original value
+	oldReadRaw := readRaw
+	defer func() { readRaw = oldReadRaw }()
+	readRaw = func(source string) (map[interface{}]interface{}, error) {
+		out := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(src, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	events := &eventLog{}
+	repo := NewRepositoryWithOptions(&RepositoryOptions{Observer: events})
+	prov, err := NewYamlProviderFromSource(repo, 0, &YamlProviderOptions{}, "dummy.dummy")
+	if err != nil {
+		t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+	}
+	if err := prov.SetUp(repo); err != nil {
+		t.Fatalf("Failed to set up yaml provider: %s", err)
+	}
+	if err := prov.reload(); err != nil {
+		t.Fatalf("Failed to reload yaml provider: %s", err)
+	}
+	src = []byte("system: [")
+	reloadErr := prov.reload()
+	if reloadErr == nil {
+		t.Fatalf("Expected the reload to fail")
+	}
+
+	got := events.summary(EventReloadStarted, EventReloadSucceeded, EventReloadFailed)
+	want := []string{
+		"reload_started:yaml",
+		"reload_succeeded:yaml",
+		"reload_started:yaml",
+		"reload_failed:yaml:" + reloadErr.Error(),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected events: got: %v, want: %v", got, want)
+	}
+}
+
+func TestLogObserver(t *testing.T) {
+	buf := &bytes.Buffer{}
+	obs := NewLogObserver(log.New(buf, "", 0))
+	obs.Observe(Event{Type: EventSetUp, Provider: "yaml", Err: fmt.Errorf("file not found")})
+	obs.Observe(Event{Type: EventKeyRegistered, Provider: "env", Key: NewKey("system.maxprocs")})
+
+	want := strings.Join([]string{
+		`config: event=setup provider=yaml error="file not found"`,
+		`config: event=key_registered provider=env key=system.maxprocs`,
+		``,
+	}, "\n")
+	if got := buf.String(); got != want {
+		t.Fatalf("Unexpected log output: got: %q, want: %q", got, want)
+	}
+}
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultHistogramBuckets are the histogram bucket upper bounds (in seconds)
+// used by PrometheusMetrics unless defined explicitly.
+var DefaultHistogramBuckets = []float64{
+	.00001, .0001, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10,
+}
+
+var metricsHelp = map[string]string{
+	MetricGetTotal:                "Total number of config Get calls.",
+	MetricCacheHitsTotal:          "Total number of config lookups served from the cache.",
+	MetricMapperDuration:          "Config value mapping latency in seconds.",
+	MetricConversionFailuresTotal: "Total number of config value conversion failures.",
+	MetricReloadsTotal:            "Total number of config source reloads.",
+	MetricReloadDuration:          "Config source reload duration in seconds.",
+	MetricLastReloadTimestamp:     "Unix time of the last successful config source reload.",
+}
+
+type metricType string
+
+const (
+	metricCounter   metricType = "counter"
+	metricGauge     metricType = "gauge"
+	metricHistogram metricType = "histogram"
+)
+
+type metricSeries struct {
+	labels string
+	value  float64
+	// histogram only
+	buckets []uint64
+	count   uint64
+}
+
+type metricFamily struct {
+	typ    metricType
+	series map[string]*metricSeries
+}
+
+// PrometheusMetrics is an in-memory Metrics implementation which renders the
+// collected metrics in Prometheus text exposition format. It can be served
+// directly as an http.Handler.
+type PrometheusMetrics struct {
+	buckets  []float64
+	families map[string]*metricFamily
+	mx       sync.Mutex
+}
+
+var _ Metrics = (*PrometheusMetrics)(nil)
+var _ http.Handler = (*PrometheusMetrics)(nil)
+
+// NewPrometheusMetrics returns a new instance of PrometheusMetrics. The
+// buckets are the histogram bucket upper bounds, DefaultHistogramBuckets are
+// used if none provided.
+func NewPrometheusMetrics(buckets []float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultHistogramBuckets
+	}
+	sorted := make([]float64, len(buckets))
+	copy(sorted, buckets)
+	sort.Float64s(sorted)
+	return &PrometheusMetrics{
+		buckets:  sorted,
+		families: make(map[string]*metricFamily),
+	}
+}
+
+// IncCounter satisfies Metrics interface.
+func (pm *PrometheusMetrics) IncCounter(name string, labels map[string]string) {
+	pm.mx.Lock()
+	defer pm.mx.Unlock()
+	if s := pm.series(name, metricCounter, labels); s != nil {
+		s.value++
+	}
+}
+
+// SetGauge satisfies Metrics interface.
+func (pm *PrometheusMetrics) SetGauge(name string, labels map[string]string, value float64) {
+	pm.mx.Lock()
+	defer pm.mx.Unlock()
+	if s := pm.series(name, metricGauge, labels); s != nil {
+		s.value = value
+	}
+}
+
+// Observe satisfies Metrics interface.
+func (pm *PrometheusMetrics) Observe(name string, labels map[string]string, value float64) {
+	pm.mx.Lock()
+	defer pm.mx.Unlock()
+	s := pm.series(name, metricHistogram, labels)
+	if s == nil {
+		return
+	}
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(pm.buckets))
+	}
+	for ix, le := range pm.buckets {
+		if value <= le {
+			s.buckets[ix]++
+		}
+	}
+	s.value += value
+	s.count++
+}
+
+// series returns the series of the metric family, creating it if needed.
+// Returns nil if the metric has been registered with a different type.
+func (pm *PrometheusMetrics) series(name string, typ metricType, labels map[string]string) *metricSeries {
+	family, ok := pm.families[name]
+	if !ok {
+		family = &metricFamily{typ: typ, series: make(map[string]*metricSeries)}
+		pm.families[name] = family
+	}
+	if family.typ != typ {
+		return nil
+	}
+	ls := formatLabels(labels)
+	s, ok := family.series[ls]
+	if !ok {
+		s = &metricSeries{labels: ls}
+		family.series[ls] = s
+	}
+	return s
+}
+
+// WriteTo writes the collected metrics in Prometheus text exposition format.
+// The metric families and the series are sorted to keep the output stable.
+func (pm *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	pm.mx.Lock()
+	defer pm.mx.Unlock()
+
+	cw := &countingWriter{w: w}
+	names := make([]string, 0, len(pm.families))
+	for name := range pm.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		family := pm.families[name]
+		if help, ok := metricsHelp[name]; ok {
+			fmt.Fprintf(cw, "# HELP %s %s\n", name, help)
+		}
+		fmt.Fprintf(cw, "# TYPE %s %s\n", name, family.typ)
+		keys := make([]string, 0, len(family.series))
+		for k := range family.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := family.series[k]
+			if family.typ != metricHistogram {
+				fmt.Fprintf(cw, "%s%s %s\n", name, wrapLabels(s.labels), formatFloat(s.value))
+				continue
+			}
+			for ix, le := range pm.buckets {
+				fmt.Fprintf(cw, "%s_bucket%s %d\n", name, wrapLabels(joinLabels(s.labels, "le="+strconv.Quote(formatFloat(le)))), s.buckets[ix])
+			}
+			fmt.Fprintf(cw, "%s_bucket%s %d\n", name, wrapLabels(joinLabels(s.labels, `le="+Inf"`)), s.count)
+			fmt.Fprintf(cw, "%s_sum%s %s\n", name, wrapLabels(s.labels), formatFloat(s.value))
+			fmt.Fprintf(cw, "%s_count%s %d\n", name, wrapLabels(s.labels), s.count)
+		}
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP satisfies http.Handler interface: the metrics are served in
+// Prometheus text exposition format.
+func (pm *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	pm.WriteTo(w)
+}
+
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders the labels sorted by name: name1="value1",...
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	chunks := make([]string, 0, len(names))
+	for _, name := range names {
+		chunks = append(chunks, name+`="`+labelValueEscaper.Replace(labels[name])+`"`)
+	}
+	return strings.Join(chunks, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if len(labels) == 0 {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrapLabels(labels string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
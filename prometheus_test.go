@@ -0,0 +1,62 @@
+package config
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	pm := NewPrometheusMetrics([]float64{1, 0.1})
+	pm.IncCounter(MetricGetTotal, map[string]string{LabelPrefix: "system"})
+	pm.IncCounter(MetricGetTotal, map[string]string{LabelPrefix: "system"})
+	pm.IncCounter(MetricGetTotal, map[string]string{LabelPrefix: "db"})
+	pm.SetGauge(MetricLastReloadTimestamp, map[string]string{LabelProvider: "yaml"}, 1600000000.5)
+	pm.Observe(MetricReloadDuration, map[string]string{LabelProvider: "yaml"}, 0.05)
+	pm.Observe(MetricReloadDuration, map[string]string{LabelProvider: "yaml"}, 0.5)
+	pm.IncCounter("custom_total", map[string]string{"path": "a\"b\\c\nd"})
+	// A type mismatch is ignored
+	pm.SetGauge(MetricGetTotal, nil, 42)
+
+	want := strings.Join([]string{
+		`# HELP config_get_total Total number of config Get calls.`,
+		`# TYPE config_get_total counter`,
+		`config_get_total{prefix="db"} 1`,
+		`config_get_total{prefix="system"} 2`,
+		`# HELP config_last_reload_timestamp_seconds Unix time of the last successful config source reload.`,
+		`# TYPE config_last_reload_timestamp_seconds gauge`,
+		`config_last_reload_timestamp_seconds{provider="yaml"} 1.6000000005e+09`,
+		`# HELP config_reload_duration_seconds Config source reload duration in seconds.`,
+		`# TYPE config_reload_duration_seconds histogram`,
+		`config_reload_duration_seconds_bucket{provider="yaml",le="0.1"} 1`,
+		`config_reload_duration_seconds_bucket{provider="yaml",le="1"} 2`,
+		`config_reload_duration_seconds_bucket{provider="yaml",le="+Inf"} 2`,
+		`config_reload_duration_seconds_sum{provider="yaml"} 0.55`,
+		`config_reload_duration_seconds_count{provider="yaml"} 2`,
+		`# TYPE custom_total counter`,
+		`custom_total{path="a\"b\\c\nd"} 1`,
+		``,
+	}, "\n")
+
+	buf := &bytes.Buffer{}
+	n, err := pm.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("Failed to write the metrics: %s", err)
+	}
+	if got := buf.String(); got != want {
+		t.Fatalf("Unexpected output:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("Unexpected number of bytes written: got: %d, want: %d", n, buf.Len())
+	}
+
+	rec := httptest.NewRecorder()
+	pm.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Body.String(); got != want {
+		t.Fatalf("Unexpected http response:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Unexpected content type: %q", ct)
+	}
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -17,8 +20,11 @@ const (
 	SystemMaxprocs = "system.maxprocs"
 )
 
-// TODO(olegs): implement listener interface
-// type Listener func(*KeyValue)
+// Listener is a callback invoked every time the effective value of a
+// subscribed key might have changed: a provider reported a change, a key
+// registration or an entire provider has been removed. kv holds the new value
+// of the key; ok is false if the key has no value anymore.
+type Listener func(kv *KeyValue, ok bool)
 
 // Provider is a generic interface for config providers.
 // A method initializing a new instance of Provider must conform to Constructor
@@ -32,6 +38,70 @@ type Provider interface {
 	Weight() int
 }
 
+// ContextSetUpProvider is an optional interface for providers supporting
+// the context-aware set up. If a provider implements it, the repository
+// calls `SetUpContext` instead of `SetUp`. The context carries the
+// cancellation signal and the deadline (see RepositoryOptions.SetUpTimeout).
+type ContextSetUpProvider interface {
+	SetUpContext(context.Context, *Repository) error
+}
+
+// ContextGetProvider is an optional interface for providers supporting
+// the context-aware lookup. If a provider implements it, the repository
+// calls `GetContext` instead of `Get`. A provider is expected to give up and
+// return nil, false once the context is done.
+type ContextGetProvider interface {
+	GetContext(context.Context, Key) (*KeyValue, bool)
+}
+
+// ContextProvider is the complete context-aware extension of Provider
+// interface, intended for network-backed and slow providers: they can honor
+// shutdown signals and request deadlines. Existing providers implementing
+// the plain Provider interface keep working as is.
+type ContextProvider interface {
+	Provider
+	ContextSetUpProvider
+	ContextGetProvider
+}
+
+func providerGet(ctx context.Context, prov Provider, key Key) (*KeyValue, bool) {
+	if cp, ok := prov.(ContextGetProvider); ok {
+		return cp.GetContext(ctx, key)
+	}
+	return prov.Get(key)
+}
+
+func providerSetUp(ctx context.Context, prov Provider, repo *Repository) error {
+	if cp, ok := prov.(ContextSetUpProvider); ok {
+		return cp.SetUpContext(ctx, repo)
+	}
+	return prov.SetUp(repo)
+}
+
+// waitReady blocks until the ready channel is closed or the context is done.
+// Returns true if the channel has been closed. A context which can never be
+// done (e.g. context.Background()) does not wait at all: a provider which
+// never gets ready (e.g. abandoned on a set up timeout) must not block the
+// lookups forever.
+func waitReady(ctx context.Context, ready chan struct{}) bool {
+	select {
+	case <-ready:
+		return true
+	default:
+	}
+	if ctx.Done() == nil {
+		return false
+	}
+	// A ready provider must never be reported as not ready: select picks a
+	// random case if both channels are closed.
+	select {
+	case <-ready:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 var (
 	mappers   *MapperNode
 	mappersMx sync.Mutex
@@ -43,52 +113,120 @@ type Constructor func(*Repository, int) (Provider, error)
 
 type node struct {
 	providers []Provider
-	//listeners []Listener
-	children map[string]*node
+	children  map[string]*node
 }
 
 func newNode() *node {
 	return &node{
 		providers: make([]Provider, 0),
-		//listeners: make([]Listener, 0),
-		children: make(map[string]*node),
+		children:  make(map[string]*node),
 	}
 }
 
-func (n *node) explain(key Key) map[string]interface{} {
+func (n *node) explain(repo *Repository, key Key) map[string]interface{} {
 	res := map[string]interface{}{}
 	if len(n.providers) > 0 {
 		valdescr := make([]map[string]interface{}, 0, len(n.providers))
 		for _, prov := range n.providers {
-			if kv, ok := prov.Get(key); ok {
-				valdescr = append(valdescr, map[string]interface{}{
+			if kv, ok := providerGet(context.Background(), prov, key); ok {
+				val := kv.Value
+				if _, wrapped := unwrapSecret(val); !wrapped && repo.isSecret(key, prov) {
+					val = NewSecretValue(val)
+				}
+				descr := map[string]interface{}{
 					"provider_name":   prov.Name(),
 					"provider_weight": prov.Weight(),
-					"value":           kv.Value,
-				})
+					"value":           val,
+				}
+				if raw, ok := providerRaw(prov, key); ok {
+					if _, wrapped := val.(SecretValue); wrapped {
+						descr["raw"] = NewSecretValue(raw)
+					} else {
+						descr["raw"] = raw
+					}
+				}
+				if !repo.allowsProvider(key, prov) {
+					descr["excluded"] = true
+				}
+				valdescr = append(valdescr, descr)
 			}
 		}
 		res["__value__"] = valdescr
 	} else if len(n.children) > 0 {
 		for k, ch := range n.children {
-			res[k] = ch.explain(append(key, k))
+			res[k] = ch.explain(repo, key.child(k))
 		}
 	}
+	if strategy := repo.mergeStrategy(key); strategy != MergeReplace {
+		res["__merge__"] = n.explainMerge(repo, key, strategy)
+	}
 	return res
 }
 
-func (n *node) add(key Key, prov Provider) {
-	ptr := n
-	for _, k := range key {
-		if _, ok := ptr.children[k]; !ok {
-			ptr.children[k] = newNode()
+func (n *node) dump(repo *Repository, key Key, res map[string]Value) {
+	if strategy := repo.mergeStrategy(key); strategy != MergeReplace && len(n.providers) > 0 {
+		mkv, secret, ok, err := repo.resolveMerged(context.Background(), n, key, strategy)
+		if err != nil {
+			panic(err)
 		}
-		ptr = ptr.children[k]
+		if ok {
+			val := mkv.Value
+			if secret {
+				val = NewSecretValue(val)
+			}
+			res[key.String()] = val
+		}
+		return
+	}
+	if n.preferLeaf(repo, key) {
+		for _, prov := range repo.keyProviders(key, n.providers) {
+			mkv, secret, ok, err := repo.doResolve(context.Background(), prov, key)
+			if err != nil {
+				panic(err)
+			}
+			if ok {
+				if secret {
+					res[key.String()] = NewSecretValue(mkv.Value)
+				} else {
+					res[key.String()] = mkv.Value
+				}
+				return
+			}
+		}
+		return
+	}
+	for k, ch := range n.children {
+		ch.dump(repo, key.child(k), res)
 	}
-	ptr.providers = append(ptr.providers, prov)
-	sort.Slice(ptr.providers, func(a, b int) bool {
-		return ptr.providers[a].Weight() > ptr.providers[b].Weight()
-	})
+}
+
+// with returns a copy of the node with the provider registered under the
+// key. The original node is never modified: the nodes are shared between
+// concurrent readers and must be treated as immutable once published.
+// Only the nodes on the key path are copied.
+func (n *node) with(key Key, prov Provider) *node {
+	cp := &node{
+		providers: n.providers,
+		children:  n.children,
+	}
+	if len(key) == 0 {
+		providers := make([]Provider, len(n.providers), len(n.providers)+1)
+		copy(providers, n.providers)
+		providers = append(providers, prov)
+		sort.SliceStable(providers, func(a, b int) bool {
+			return providers[a].Weight() > providers[b].Weight()
+		})
+		cp.providers = providers
+		return cp
+	}
+	children := copyChildren(n.children)
+	ch, ok := children[key[0]]
+	if !ok {
+		ch = newNode()
+	}
+	children[key[0]] = ch.with(key[1:], prov)
+	cp.children = children
+	return cp
 }
 
 func (n *node) find(key Key) *node {
@@ -102,66 +240,161 @@ func (n *node) find(key Key) *node {
 	return ptr
 }
 
-func (n *node) findOrCreate(key Key) *node {
-	ptr := n
-	for _, k := range key {
-		if _, ok := ptr.children[k]; !ok {
-			ptr.children[k] = newNode()
+// without returns a copy of the node with the provider registration under
+// the key removed. Empty nodes are pruned: the result is nil if the node has
+// neither providers nor children anymore. The bool flag indicates whether
+// the registration has been found. The original node is never modified.
+func (n *node) without(key Key, prov Provider) (*node, bool) {
+	cp := &node{
+		providers: n.providers,
+		children:  n.children,
+	}
+	if len(key) == 0 {
+		cp.providers = excludeProvider(n.providers, prov)
+		if len(cp.providers) == len(n.providers) {
+			return n, false
+		}
+	} else {
+		ch, ok := n.children[key[0]]
+		if !ok {
+			return n, false
+		}
+		newCh, found := ch.without(key[1:], prov)
+		if !found {
+			return n, false
+		}
+		cp.children = copyChildren(n.children)
+		if newCh != nil {
+			cp.children[key[0]] = newCh
+		} else {
+			delete(cp.children, key[0])
 		}
-		ptr = ptr.children[k]
 	}
-	return ptr
+	if len(cp.providers) == 0 && len(cp.children) == 0 {
+		return nil, true
+	}
+	return cp, true
 }
 
-// func (n *node) subscribe(key Key, listener Listener) {
-// 	panic("not implemented")
-// }
+// withoutProvider returns a copy of the node with all the provider
+// registrations removed. The removed registration keys are appended to
+// removed. Empty nodes are pruned the same way as in `without()`.
+// If the provider serves no keys in the sub-tree, returns the node itself.
+func (n *node) withoutProvider(key Key, prov Provider, removed *[]Key) *node {
+	providers := excludeProvider(n.providers, prov)
+	if len(providers) != len(n.providers) {
+		*removed = append(*removed, key)
+	}
+	// children stays nil as long as the sub-tree is intact
+	var children map[string]*node
+	for k, ch := range n.children {
+		newCh := ch.withoutProvider(key.child(k), prov, removed)
+		if newCh == ch {
+			continue
+		}
+		if children == nil {
+			children = copyChildren(n.children)
+		}
+		if newCh != nil {
+			children[k] = newCh
+		} else {
+			delete(children, k)
+		}
+	}
+	if children == nil {
+		if len(providers) == len(n.providers) {
+			return n
+		}
+		children = n.children
+	}
+	if len(providers) == 0 && len(children) == 0 {
+		return nil
+	}
+	return &node{
+		providers: providers,
+		children:  children,
+	}
+}
+
+func excludeProvider(providers []Provider, prov Provider) []Provider {
+	res := make([]Provider, 0, len(providers))
+	for _, p := range providers {
+		if p != prov {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+func copyChildren(children map[string]*node) map[string]*node {
+	res := make(map[string]*node, len(children))
+	for k, ch := range children {
+		res[k] = ch
+	}
+	return res
+}
 
-func (n *node) get(repo *Repository, key Key) (*KeyValue, bool) {
+func (n *node) get(ctx context.Context, repo *Repository, key Key) (*KeyValue, bool) {
 	ptr := n.find(key)
 	if ptr == nil {
 		return nil, false
 	}
-	if len(ptr.providers) != 0 {
-		for _, prov := range ptr.providers {
-			if kv, ok := prov.Get(key); ok {
-				if mkv, err := repo.doMap(kv); err != nil {
-					panic(err)
-				} else {
-					return mkv, ok
-				}
+	if strategy := repo.mergeStrategy(key); strategy != MergeReplace {
+		mkv, _, ok, err := repo.resolveMerged(ctx, ptr, key, strategy)
+		if err != nil {
+			panic(err)
+		}
+		return mkv, ok
+	}
+	if ptr.preferLeaf(repo, key) {
+		for _, prov := range repo.keyProviders(key, ptr.providers) {
+			mkv, ok, err := repo.resolve(ctx, prov, key)
+			if err != nil {
+				panic(err)
+			}
+			if ok {
+				return mkv, ok
 			}
 		}
 		return nil, false
 	}
 	if len(ptr.children) != 0 {
-		return ptr.getAll(repo, key), true
+		return ptr.getAll(ctx, repo, key), true
 	}
 	return nil, false
 }
 
-func (n *node) getAll(repo *Repository, pref Key) *KeyValue {
+func (n *node) getAll(ctx context.Context, repo *Repository, pref Key) *KeyValue {
 	res := make(map[string]Value)
 	for k, ch := range n.children {
-		key := Key(append(pref, k))
-		if len(ch.providers) > 0 {
+		key := pref.child(k)
+		if strategy := repo.mergeStrategy(key); strategy != MergeReplace {
+			mkv, _, ok, err := repo.resolveMerged(ctx, ch, key, strategy)
+			if err != nil {
+				panic(err)
+			}
+			if ok {
+				res[k] = mkv.Value
+			}
+		} else if ch.preferLeaf(repo, key) {
 			// Providers are expected to be sorted
-			for _, prov := range ch.providers {
-				if kv, ok := prov.Get(key); ok {
-					mkv, err := repo.doMap(kv)
-					if err != nil {
-						panic(err)
-					}
+			for _, prov := range repo.keyProviders(key, ch.providers) {
+				mkv, ok, err := repo.resolve(ctx, prov, key)
+				if err != nil {
+					panic(err)
+				}
+				if ok {
 					res[k] = mkv.Value
 					break
 				}
 			}
 		} else {
-			res[k] = ch.getAll(repo, key).Value
+			res[k] = ch.getAll(ctx, repo, key).Value
 		}
 	}
-	mkv, err := repo.doMap(&KeyValue{Key: pref, Value: res})
+	mkv, err := repo.doMap(&KeyValue{Key: pref, Value: assemble(res)})
 	if err != nil {
+		repo.Emit(Event{Type: EventConversionFailed, Key: pref, Err: err})
 		panic(err)
 	}
 	return mkv
@@ -174,71 +407,196 @@ func (n *node) getAll(repo *Repository, pref Key) *KeyValue {
 // settings and might be used by any consumer.
 // Plugin code can instantiate and use locally defined repositories. Having
 // independent repositories is practical.
+//
+// Repository is safe for concurrent use. The key trie and the schema are
+// copy-on-write structures: readers never block, whereas writers (key
+// registration, schema definition) are serialized and publish a new version
+// of the structure atomically.
 type Repository struct {
-	mappers   *MapperNode
-	root      *node
+	// generation is accessed atomically and goes first to guarantee 64-bit
+	// alignment on 32-bit platforms.
+	generation uint64
+	// mappers holds the current *MapperNode
+	mappers atomic.Value
+	// root holds the current *node
+	root      atomic.Value
 	providers map[string]Provider
 	mx        sync.Mutex
+	cache     *valueCache
+	listeners map[string][]*subscription
+	lmx       sync.Mutex
+	// changeMx locks the provider state changes out of the exclusive
+	// snapshot collection
+	changeMx sync.RWMutex
+	setUp    map[string]bool
+	audit    *auditor
+	options  *RepositoryOptions
+}
+
+type subscription struct {
+	key      Key
+	listener Listener
+}
+
+// RepositoryOptions is a set of optional repository settings.
+type RepositoryOptions struct {
+	// Cache enables caching of resolved and mapped values per key.
+	// A cached value is invalidated on a key registration, a schema
+	// definition or a change reported by a provider (see ReportChange).
+	// Providers changing their values without reporting it must not be
+	// used with the cache enabled.
+	Cache bool
+	// SetUpTimeout limits the duration of every provider SetUp call.
+	// Zero means no timeout.
+	SetUpTimeout time.Duration
+	// Observer receives the repository lifecycle events (see Event).
+	// Nil means no events are emitted.
+	Observer Observer
+	// Metrics receives the repository instrumentation (see Metrics).
+	// Nil disables the instrumentation.
+	Metrics Metrics
+	// MetricsPrefixDepth is the number of key fragments used as the key
+	// prefix metric label. Defaults to 1.
+	MetricsPrefixDepth int
+	// AuditSink receives every change of the effective config (see
+	// AuditEntry). Nil means no external sink.
+	AuditSink AuditSink
+	// AuditHistorySize is the number of the latest effective config changes
+	// kept in memory (see History). Zero disables the history.
+	AuditHistorySize int
+	// ProviderRules pin or exclude providers per key pattern, overriding the
+	// global weight order (see ProviderRule). The schema might declare the
+	// rules as well (see Pin and Exclude).
+	ProviderRules []ProviderRule
 }
 
 // NewRepository returns a new instance of an empty Repository.
 func NewRepository() *Repository {
-	return &Repository{
-		mappers:   NewMapperNode(),
-		root:      newNode(),
+	return NewRepositoryWithOptions(&RepositoryOptions{})
+}
+
+// NewRepositoryWithOptions returns a new instance of an empty Repository
+// configured according to the options.
+func NewRepositoryWithOptions(options *RepositoryOptions) *Repository {
+	repo := &Repository{
 		providers: make(map[string]Provider),
 		mx:        sync.Mutex{},
+		listeners: make(map[string][]*subscription),
+		setUp:     make(map[string]bool),
+		options:   options,
+		audit:     newAuditor(options),
+	}
+	repo.mappers.Store(NewMapperNode())
+	repo.root.Store(newNode())
+	if options.Cache {
+		repo.cache = newValueCache()
 	}
+	return repo
 }
 
 // SetUp traverses registered providers and calls `provider.SetUp(repo)`.
 // Providers are traversed in topological order, based on the dependencies
 // they defined using `Depends()` method.
 // Firstly, it sets up providers with no dependencies and progresses forward
-// as providers with non-zero dependencies turn to be unblocked.
-// Returns an error if at least 1 provider failed to call `SetUp`.
+// as providers with non-zero dependencies turn to be unblocked. Independent
+// providers are set up concurrently.
+// Returns an error if at least 1 provider failed to call `SetUp` or a hard
+// dependency of a provider is not registered (see UnmetDependenciesError).
+// See SetUpContext for more details.
 func (repo *Repository) SetUp() error {
-	providers, err := repo.traverseProviders()
-	if err != nil {
-		return err
-	}
-	for _, prov := range providers {
-		if err := prov.SetUp(repo); err != nil {
-			return err
-		}
-	}
-
-	return nil
+	return repo.SetUpContext(context.Background())
 }
 
 // TearDown does the opposite to `SetUp`: it prepares providers to get
-// unloaded. The sequence of `provider.TearDown(repo)` is exactly the same
-// as SetUp(): topologically sorted dependency list.
-// Returns an error if at least 1 provider failed to call `TearDown`.
+// unloaded. The sequence of `provider.TearDown(repo)` is the reverse of
+// SetUp(): a provider is torn down before the providers it depends on.
+// A failed provider TearDown does not stop the process: all providers are
+// visited and the errors are combined in a MultiError (a single error is
+// returned as is).
 func (repo *Repository) TearDown() error {
 	providers, err := repo.traverseProviders()
 	if err != nil {
 		return err
 	}
-	for _, prov := range providers {
-		if err := prov.TearDown(repo); err != nil {
-			return err
-		}
+	return combineErrors(repo.tearDownProviders(providers))
+}
+
+// loadRoot returns the current version of the key trie.
+func (repo *Repository) loadRoot() *node {
+	return repo.root.Load().(*node)
+}
+
+// loadMappers returns the current version of the schema.
+func (repo *Repository) loadMappers() *MapperNode {
+	return repo.mappers.Load().(*MapperNode)
+}
+
+// providerMap returns a copy of the registered provider map.
+func (repo *Repository) providerMap() map[string]Provider {
+	repo.mx.Lock()
+	defer repo.mx.Unlock()
+	res := make(map[string]Provider, len(repo.providers))
+	for name, prov := range repo.providers {
+		res[name] = prov
 	}
-	return nil
+	return res
 }
 
-func (repo *Repository) traverseProviders() ([]Provider, error) {
-	provList := make([]TopologyNode, 0, len(repo.providers))
-	for _, prov := range repo.providers {
+// providerTopology builds the provider dependency graph. A dependency on a
+// provider type connects the provider to all the instances of the type.
+// Soft dependencies on unregistered providers are ignored.
+// Returns UnmetDependenciesError if a hard dependency could not be satisfied.
+func (repo *Repository) providerTopology() (*Topology, error) {
+	providers := repo.providerMap()
+	provList := make([]TopologyNode, 0, len(providers))
+	for _, prov := range providers {
 		provList = append(provList, prov)
 	}
 	top := NewTopology(provList...)
-	for name, prov := range repo.providers {
+	unmet := make([]UnmetDependency, 0)
+	for name, prov := range providers {
 		for _, dep := range prov.Depends() {
-			top.Connect(repo.providers[name], repo.providers[dep])
+			depName, soft := parseDependency(dep)
+			found := false
+			for dn, depProv := range providers {
+				if dn == name || !satisfiesDependency(dn, depName) {
+					continue
+				}
+				found = true
+				if err := top.Connect(prov, depProv); err != nil {
+					return nil, err
+				}
+			}
+			if !found && !soft {
+				unmet = append(unmet, UnmetDependency{Provider: name, Dependency: depName})
+			}
 		}
 	}
+	if len(unmet) > 0 {
+		sort.Slice(unmet, func(a, b int) bool {
+			if unmet[a].Provider != unmet[b].Provider {
+				return unmet[a].Provider < unmet[b].Provider
+			}
+			return unmet[a].Dependency < unmet[b].Dependency
+		})
+		return nil, &UnmetDependenciesError{Unmet: unmet}
+	}
+	return top, nil
+}
+
+// ProviderGraph returns the provider dependency graph: the nodes are the
+// registered providers, an edge from A to B means A depends on B. The graph
+// can be sorted, split into layers or exported in DOT format.
+// Returns an error if a hard dependency could not be satisfied.
+func (repo *Repository) ProviderGraph() (*Topology, error) {
+	return repo.providerTopology()
+}
+
+func (repo *Repository) traverseProviders() ([]Provider, error) {
+	top, err := repo.providerTopology()
+	if err != nil {
+		return []Provider{}, err
+	}
 	resolved, err := top.Sort()
 	if err != nil {
 		return []Provider{}, err
@@ -254,18 +612,82 @@ func (repo *Repository) traverseProviders() ([]Provider, error) {
 // Multiple non-overlapping schemas might be registered sequentually with
 // an equivalence of registering a composite schema at once.
 // Returns an error if the root mapper node failes to register the schema.
+// A schema failed to register is not applied partially.
+// This method is thread safe.
 func (repo *Repository) DefineSchema(s Schema) error {
-	return repo.mappers.DefineSchema(s)
+	repo.mx.Lock()
+	mappers := repo.loadMappers().clone()
+	if err := mappers.DefineSchema(s); err != nil {
+		repo.mx.Unlock()
+		return err
+	}
+	repo.mappers.Store(mappers)
+	repo.invalidate(nil)
+	repo.mx.Unlock()
+
+	repo.auditChange(nil, nil)
+
+	return nil
 }
 
 func (repo *Repository) doMap(kv *KeyValue) (*KeyValue, error) {
-	return repo.mappers.Map(kv)
+	if repo.options.Metrics != nil {
+		defer repo.timeMapping(kv.Key, time.Now())
+	}
+	return repo.loadMappers().Map(kv)
+}
+
+// resolve fetches the value for the key from the provider and maps it
+// according to the schema. The bool flag indicates whether the provider
+// returned a value.
+func (repo *Repository) resolve(ctx context.Context, prov Provider, key Key) (*KeyValue, bool, error) {
+	mkv, _, ok, err := repo.doResolve(ctx, prov, key)
+	return mkv, ok, err
+}
+
+// doResolve is the same as resolve, but also reports whether the value is
+// sensitive. Secret values are unwrapped before mapping so the mappers
+// always operate on real values. Mapping errors for secret values never
+// include the value itself.
+func (repo *Repository) doResolve(ctx context.Context, prov Provider, key Key) (*KeyValue, bool, bool, error) {
+	kv, ok := providerGet(ctx, prov, key)
+	if !ok {
+		return nil, false, false, nil
+	}
+	val, secret := unwrapSecret(kv.Value)
+	if secret {
+		kv = &KeyValue{Key: kv.Key, Value: val}
+	}
+	secret = secret || repo.isSecret(key, prov)
+	mkv, err := repo.doMap(kv)
+	if err != nil {
+		// An inferred value type might not match the schema: the raw
+		// input is the last resort
+		if raw, ok := providerRaw(prov, key); ok {
+			if rkv, rerr := repo.doMap(&KeyValue{Key: kv.Key, Value: raw}); rerr == nil {
+				return rkv, secret, true, nil
+			}
+		}
+		if secret {
+			err = fmt.Errorf("Failed to map a secret value for key %q", key)
+		}
+		repo.Emit(Event{Type: EventConversionFailed, Provider: prov.Name(), Key: key, Err: err})
+		return nil, secret, false, err
+	}
+	return mkv, secret, true, nil
+}
+
+func (repo *Repository) isSecret(key Key, prov Provider) bool {
+	return isSecretProvider(prov) || repo.loadMappers().IsSecret(key)
 }
 
 // RegisterProvider marks a provider as known to the repository.
 // A registered provider will be visited by `SetUp` and `TearDown` methods,
 // but won't serve any key lookup requests yet. Used at the very early stage
 // of the system initialization in order to trigger providers's `SetUp` method.
+// A provider registered under the same name is replaced: it is not visited by
+// `SetUp` and `TearDown` anymore (the keys it has registered are kept). Use
+// RegisterNewProvider to detect the name clashes.
 // This method is thread safe.
 func (repo *Repository) RegisterProvider(prov Provider) {
 	repo.mx.Lock()
@@ -273,6 +695,22 @@ func (repo *Repository) RegisterProvider(prov Provider) {
 	repo.providers[prov.Name()] = prov
 }
 
+// RegisterNewProvider is the same as RegisterProvider, but fails if another
+// provider has been registered under the same name: use provider instance
+// names (see ProviderName) to register multiple providers of the same type.
+// Registering the same provider twice is not an error. The built-in provider
+// constructors register the providers this way.
+// This method is thread safe.
+func (repo *Repository) RegisterNewProvider(prov Provider) error {
+	repo.mx.Lock()
+	defer repo.mx.Unlock()
+	if registered, ok := repo.providers[prov.Name()]; ok && registered != prov {
+		return fmt.Errorf("provider %q is already registered, consider using an instance name", prov.Name())
+	}
+	repo.providers[prov.Name()] = prov
+	return nil
+}
+
 // RegisterKey registers a provider as a potential servant for the specified
 // key.
 // If a provider can serve multiple keys, every key registration must be
@@ -283,37 +721,276 @@ func (repo *Repository) RegisterKey(key Key, prov Provider) error {
 		return fmt.Errorf("provider for key %s can not be nil", key)
 	}
 	repo.mx.Lock()
-	defer repo.mx.Unlock()
-	repo.root.add(key, prov)
+	repo.root.Store(repo.loadRoot().with(key, prov))
 	if _, ok := repo.providers[prov.Name()]; !ok {
 		repo.providers[prov.Name()] = prov
 	}
+	repo.invalidate(key)
+	repo.mx.Unlock()
+
+	repo.Emit(Event{Type: EventKeyRegistered, Provider: prov.Name(), Key: key})
+	// The registrations made while setting up are audited once the set up
+	// is complete
+	if repo.isSetUp(prov.Name()) {
+		repo.auditChange(prov, []Key{key})
+	}
+
+	return nil
+}
+
+// ReportChange notifies the repository about a change of the values served
+// by the provider. Providers supporting dynamic config re-build (e.g. a file
+// watcher) are expected to call it every time they updated the values for
+// the listed keys. If no keys are provided, the change is considered global.
+// Every call increments the repository generation and invalidates the
+// cached values for the listed keys.
+// This method is thread safe.
+func (repo *Repository) ReportChange(prov Provider, keys ...Key) {
+	if len(keys) == 0 {
+		repo.invalidate(nil)
+	}
+	for _, key := range keys {
+		repo.invalidate(key)
+	}
+	repo.auditChange(prov, keys)
+	repo.notify(keys)
+}
+
+// Change runs fn replacing the provider state (e.g. swapping a re-read
+// registry). Dynamic providers are expected to replace their values this way
+// and call ReportChange afterwards. The generation is incremented before and
+// after the replacement: a snapshot collected concurrently is either repeated
+// or collected with the replacements locked out (see Snapshot). The
+// replacements do not exclude each other. fn must be short and must not call
+// Snapshot.
+// This method is thread safe.
+func (repo *Repository) Change(fn func()) {
+	repo.changeMx.RLock()
+	defer repo.changeMx.RUnlock()
+	atomic.AddUint64(&repo.generation, 1)
+	fn()
+	atomic.AddUint64(&repo.generation, 1)
+}
+
+// UnregisterKey does the opposite to `RegisterKey`: the provider would not
+// serve the key anymore. Empty key trie nodes are pruned. The subscribers of
+// the key are notified.
+// Returns an error if the provider has not been registered for the key.
+// This method is thread safe.
+func (repo *Repository) UnregisterKey(key Key, prov Provider) error {
+	if prov == nil {
+		return fmt.Errorf("provider for key %s can not be nil", key)
+	}
+	repo.mx.Lock()
+	root, found := repo.loadRoot().without(key, prov)
+	if !found {
+		repo.mx.Unlock()
+		return fmt.Errorf("provider %q is not registered for key %s", prov.Name(), key)
+	}
+	if root == nil {
+		root = newNode()
+	}
+	repo.root.Store(root)
+	repo.invalidate(key)
+	repo.mx.Unlock()
+
+	repo.auditChange(prov, []Key{key})
+	repo.notify([]Key{key})
 
 	return nil
 }
 
-//func (repo *Repository) Subscribe(key cast.Key, listener Listener) {
-//	repo.root.subscribe(key, listener)
-//}
+// UnregisterProvider removes the provider with the given name from the
+// repository along with all the key registrations it has made. The provider's
+// `TearDown` is called afterwards and the subscribers of the removed keys are
+// notified.
+// Returns an error if the provider is unknown or it's `TearDown` failed.
+// This method is thread safe.
+func (repo *Repository) UnregisterProvider(name string) error {
+	repo.mx.Lock()
+	prov, ok := repo.providers[name]
+	if !ok {
+		repo.mx.Unlock()
+		return fmt.Errorf("provider %q is not registered", name)
+	}
+	delete(repo.providers, name)
+	delete(repo.setUp, name)
+	removed := repo.withoutProviderKeys(prov)
+	repo.mx.Unlock()
+
+	err := repo.tearDownProvider(prov)
+	if len(removed) > 0 {
+		repo.auditChange(prov, removed)
+		repo.notify(removed)
+	}
+
+	return err
+}
+
+// removeProviderKeys removes all the key registrations of the provider. The
+// provider itself stays registered. The removal is reported to the audit and
+// the subscribers.
+func (repo *Repository) removeProviderKeys(prov Provider) {
+	repo.mx.Lock()
+	removed := repo.withoutProviderKeys(prov)
+	repo.mx.Unlock()
+	if len(removed) > 0 {
+		repo.auditChange(prov, removed)
+		repo.notify(removed)
+	}
+}
+
+// withoutProviderKeys removes all the key registrations of the provider from
+// the trie and returns the removed keys. Must be called with the repo lock
+// held.
+func (repo *Repository) withoutProviderKeys(prov Provider) []Key {
+	removed := make([]Key, 0)
+	root := repo.loadRoot().withoutProvider(nil, prov, &removed)
+	if root == nil {
+		root = newNode()
+	}
+	repo.root.Store(root)
+	for _, key := range removed {
+		repo.invalidate(key)
+	}
+	return removed
+}
+
+// Subscribe registers a listener for the key. The listener is called every
+// time the effective value of the key might have changed, including the
+// changes of it's sub-keys. Returns a function cancelling the subscription.
+// This method is thread safe.
+func (repo *Repository) Subscribe(key Key, listener Listener) func() {
+	sub := &subscription{key: key, listener: listener}
+	repo.lmx.Lock()
+	defer repo.lmx.Unlock()
+	repo.listeners[key.String()] = append(repo.listeners[key.String()], sub)
+	return func() {
+		repo.lmx.Lock()
+		defer repo.lmx.Unlock()
+		subs := repo.listeners[key.String()]
+		for ix, s := range subs {
+			if s == sub {
+				subs = append(subs[:ix:ix], subs[ix+1:]...)
+				break
+			}
+		}
+		if len(subs) == 0 {
+			delete(repo.listeners, key.String())
+		} else {
+			repo.listeners[key.String()] = subs
+		}
+	}
+}
+
+// notify calls the listeners subscribed to the changed keys, their parent
+// keys and their sub-keys. An empty list of keys notifies all listeners.
+// Listeners are called synchronously and must not be invoked while the
+// repository lock is being held.
+func (repo *Repository) notify(keys []Key) {
+	repo.lmx.Lock()
+	subs := make([]*subscription, 0)
+	for _, candidates := range repo.listeners {
+		for _, sub := range candidates {
+			if len(keys) == 0 || sub.key.relatesToAny(keys) {
+				subs = append(subs, sub)
+			}
+		}
+	}
+	repo.lmx.Unlock()
+
+	for _, sub := range subs {
+		var kv *KeyValue
+		var ok bool
+		if len(sub.key) != 0 {
+			kv, ok = repo.get(context.Background(), sub.key)
+		}
+		sub.listener(kv, ok)
+	}
+}
+
+// Generation returns the current repository generation. The generation is
+// a counter incremented every time the effective config might have changed:
+// a key registration, a schema definition or a provider-reported change.
+// Comparing generations is a cheap way to figure out whether a previously
+// fetched value or a Snapshot is stale.
+// This method is thread safe.
+func (repo *Repository) Generation() uint64 {
+	return atomic.LoadUint64(&repo.generation)
+}
+
+// invalidate increments the repository generation and drops the cached
+// values for the key. An empty key invalidates the entire cache.
+func (repo *Repository) invalidate(key Key) {
+	atomic.AddUint64(&repo.generation, 1)
+	if repo.cache != nil {
+		repo.cache.invalidate(key)
+	}
+}
 
 // Get is the primary interface for the stored data retrieval.
 // Returns the fetched value and a bool flag indicating the lookup result.
 // If no value was retrived from the providers, bool flag is set to false.
 func (repo *Repository) Get(key Key) (Value, bool) {
+	return repo.GetContext(context.Background(), key)
+}
+
+// GetContext is the same as Get, but it passes the context down to the
+// providers implementing ContextProvider interface: slow providers are
+// expected to give up once the context is done.
+// If the context is done before the lookup completes, returns nil, false:
+// a partially resolved value is never returned.
+func (repo *Repository) GetContext(ctx context.Context, key Key) (Value, bool) {
 	// Non-empty key check prevents users from accessing a protected
 	// root node
 	if len(key) != 0 {
-		if kv, ok := repo.root.get(repo, key); ok {
+		if metrics := repo.options.Metrics; metrics != nil {
+			metrics.IncCounter(MetricGetTotal, map[string]string{LabelPrefix: repo.metricsPrefix(key)})
+		}
+		if kv, ok := repo.get(ctx, key); ok {
 			return kv.Value, ok
 		}
 	}
 	return nil, false
 }
 
+func (repo *Repository) get(ctx context.Context, key Key) (*KeyValue, bool) {
+	if repo.cache == nil {
+		kv, ok := repo.loadRoot().get(ctx, repo, key)
+		if ctx.Err() != nil {
+			return nil, false
+		}
+		return kv, ok
+	}
+	if kv, ok, hit := repo.cache.get(key); hit {
+		if metrics := repo.options.Metrics; metrics != nil {
+			metrics.IncCounter(MetricCacheHitsTotal, map[string]string{LabelPrefix: repo.metricsPrefix(key)})
+		}
+		return kv, ok
+	}
+	epoch := repo.cache.currentEpoch()
+	kv, ok := repo.loadRoot().get(ctx, repo, key)
+	if ctx.Err() != nil {
+		return nil, false
+	}
+	repo.cache.set(key, kv, ok, epoch)
+	return kv, ok
+}
+
 // Explain returns a structure with a detailed explanation of the repository.
 // The resulting map mimics the original config map structure and leafs
 // indicate per-provider breakdown with a corresponding value returned by
 // each of them.
+// Secret values are wrapped in SecretValue and never printed.
 func (repo *Repository) Explain() map[string]interface{} {
-	return repo.root.explain(nil)
+	return repo.loadRoot().explain(repo, nil)
+}
+
+// Dump returns a flat map of the effective leaf values: the keys are
+// complete config keys joined with KeySepCh. Secret values are wrapped in
+// SecretValue, which makes the result safe to be logged or printed.
+func (repo *Repository) Dump() map[string]Value {
+	res := make(map[string]Value)
+	repo.loadRoot().dump(repo, nil, res)
+	return res
 }
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -25,7 +27,7 @@ type queueItem struct {
 func flattenRepo(repo *Repository) map[string][]Provider {
 	res := make(map[string][]Provider)
 	queue := make([]queueItem, 0, 1)
-	queue = append(queue, queueItem{nil, repo.root})
+	queue = append(queue, queueItem{nil, repo.loadRoot()})
 	var head queueItem
 	for len(queue) > 0 {
 		head, queue = queue[0], queue[1:]
@@ -33,7 +35,7 @@ func flattenRepo(repo *Repository) map[string][]Provider {
 			res[head.k.String()] = head.n.providers
 		} else if len(head.n.children) > 0 {
 			for k, n := range head.n.children {
-				queue = append(queue, queueItem{append(head.k, k), n})
+				queue = append(queue, queueItem{head.k.child(k), n})
 			}
 		}
 	}
@@ -337,7 +339,7 @@ func Test_getAll(t *testing.T) {
 		},
 		"bar": 20,
 	}
-	got := n.getAll(repo, nil).Value
+	got := n.getAll(context.Background(), repo, nil).Value
 	if !reflect.DeepEqual(want, got) {
 		t.Fatalf("Unexpcted traversal value: want: %#v, got: %#v", want, got)
 	}
@@ -617,3 +619,389 @@ func TestExplain(t *testing.T) {
 		t.Fatalf("repo.Explain() = %#v, want: %#v", got, want)
 	}
 }
+
+// TestConcurrentAccess is expected to be run with the race detector enabled.
+func TestConcurrentAccess(t *testing.T) {
+	for _, options := range []*RepositoryOptions{{}, {Cache: true}} {
+		options := options
+		t.Run(fmt.Sprintf("Cache: %t", options.Cache), func(t *testing.T) {
+			repo := NewRepositoryWithOptions(options)
+			prov := NewTestProv("42", 10)
+			const writers, readers, keys = 4, 4, 50
+
+			var wg sync.WaitGroup
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for k := 0; k < keys; k++ {
+						key := NewKey(fmt.Sprintf("foo.bar%d.baz%d", w, k))
+						if err := repo.RegisterKey(key, prov); err != nil {
+							t.Errorf("Failed to register key %q: %s", key, err)
+						}
+						if k%10 == 0 {
+							repo.DefineSchema(map[string]Schema{
+								"foo": map[string]Schema{
+									fmt.Sprintf("bar%d", w): map[string]Schema{
+										fmt.Sprintf("baz%d", k): ToInt,
+									},
+								},
+							})
+						}
+						repo.ReportChange(prov, key)
+					}
+				}(w)
+			}
+			for r := 0; r < readers; r++ {
+				wg.Add(1)
+				go func(r int) {
+					defer wg.Done()
+					for k := 0; k < keys; k++ {
+						repo.Get(NewKey("foo"))
+						repo.Get(NewKey(fmt.Sprintf("foo.bar%d", r)))
+						repo.Get(NewKey(fmt.Sprintf("foo.bar%d.baz%d", r, k)))
+						repo.Explain()
+						repo.Dump()
+						repo.Snapshot()
+					}
+				}(r)
+			}
+			wg.Wait()
+
+			for w := 0; w < writers; w++ {
+				for k := 0; k < keys; k++ {
+					key := NewKey(fmt.Sprintf("foo.bar%d.baz%d", w, k))
+					if _, ok := repo.Get(key); !ok {
+						t.Fatalf("Failed to find a registered key %q", key)
+					}
+				}
+			}
+		})
+	}
+}
+
+// namedTestProv is the configurable test provider: it serves the value under
+// the given name and delegates SetUp and TearDown to the optional hooks.
+type namedTestProv struct {
+	*TestProv
+	name     string
+	deps     []string
+	setUp    func() error
+	tearDown func() error
+	tornDown bool
+}
+
+func newNamedTestProv(name string, val Value, weight int) *namedTestProv {
+	return &namedTestProv{TestProv: NewTestProv(val, weight), name: name}
+}
+
+// newHookTestProv returns a provider serving its own name with the
+// dependencies and the SetUp hook defined.
+func newHookTestProv(name string, deps []string, setUp func() error) *namedTestProv {
+	prov := newNamedTestProv(name, name, 10)
+	prov.deps, prov.setUp = deps, setUp
+	return prov
+}
+
+// logSetUp returns a SetUp hook recording the provider name in the log.
+func logSetUp(log *[]string, name string) func() error {
+	return func() error {
+		*log = append(*log, name)
+		return nil
+	}
+}
+
+func (ntp *namedTestProv) Name() string      { return ntp.name }
+func (ntp *namedTestProv) Depends() []string { return ntp.deps }
+
+func (ntp *namedTestProv) SetUp(repo *Repository) error {
+	if ntp.setUp != nil {
+		if err := ntp.setUp(); err != nil {
+			return err
+		}
+	}
+	return ntp.TestProv.SetUp(repo)
+}
+
+func (ntp *namedTestProv) TearDown(_ *Repository) error {
+	ntp.tornDown = true
+	if ntp.tearDown != nil {
+		return ntp.tearDown()
+	}
+	return nil
+}
+
+func TestUnregisterKey(t *testing.T) {
+	repo := NewRepositoryWithOptions(&RepositoryOptions{Cache: true})
+	prov1 := NewTestProv(10, 10)
+	prov2 := NewTestProv(20, 20)
+	repo.RegisterKey(NewKey("foo.bar"), prov1)
+	repo.RegisterKey(NewKey("foo.bar"), prov2)
+	repo.RegisterKey(NewKey("foo.baz.moo"), prov2)
+
+	if got, _ := repo.Get(NewKey("foo.bar")); got != 20 {
+		t.Fatalf("Unexpected value for key %q: got: %#v, want: %#v", "foo.bar", got, 20)
+	}
+
+	if err := repo.UnregisterKey(NewKey("foo.bar"), prov2); err != nil {
+		t.Fatalf("Failed to unregister key: %s", err)
+	}
+	if got, _ := repo.Get(NewKey("foo.bar")); got != 10 {
+		t.Fatalf("Unexpected value for key %q: got: %#v, want: %#v", "foo.bar", got, 10)
+	}
+
+	if err := repo.UnregisterKey(NewKey("foo.baz.moo"), prov2); err != nil {
+		t.Fatalf("Failed to unregister key: %s", err)
+	}
+	if _, ok := repo.Get(NewKey("foo.baz")); ok {
+		t.Fatalf("Expected the empty key %q to be pruned", "foo.baz")
+	}
+	want := map[string][]Provider{"foo.bar": {prov1}}
+	if got := flattenRepo(repo); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected repo state: got: %#v, want: %#v", got, want)
+	}
+
+	if err := repo.UnregisterKey(NewKey("foo.bar"), prov2); err == nil {
+		t.Fatalf("Expected an error for a non-registered provider")
+	}
+	if err := repo.UnregisterKey(NewKey("foo.moo"), prov1); err == nil {
+		t.Fatalf("Expected an error for a non-registered key")
+	}
+}
+
+func TestUnregisterProvider(t *testing.T) {
+	repo := NewRepository()
+	prov1 := newNamedTestProv("prov1", 10, 10)
+	prov2 := newNamedTestProv("prov2", 20, 20)
+	repo.RegisterKey(NewKey("foo.bar"), prov1)
+	repo.RegisterKey(NewKey("foo.bar"), prov2)
+	repo.RegisterKey(NewKey("foo.baz.moo"), prov2)
+	repo.RegisterKey(NewKey("boo"), prov2)
+
+	if err := repo.UnregisterProvider("prov2"); err != nil {
+		t.Fatalf("Failed to unregister provider: %s", err)
+	}
+	if !prov2.tornDown {
+		t.Fatalf("Expected the provider to be torn down")
+	}
+	want := map[string][]Provider{"foo.bar": {prov1}}
+	if got := flattenRepo(repo); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected repo state: got: %#v, want: %#v", got, want)
+	}
+	if _, ok := repo.providerMap()["prov2"]; ok {
+		t.Fatalf("Expected the provider to be removed from the provider list")
+	}
+	if err := repo.UnregisterProvider("prov2"); err == nil {
+		t.Fatalf("Expected an error for an unknown provider")
+	}
+}
+
+func TestRegisterNewProvider(t *testing.T) {
+	repo := NewRepository()
+	prov := newNamedTestProv("prov", 10, 10)
+	if err := repo.RegisterNewProvider(prov); err != nil {
+		t.Fatalf("Failed to register a new provider: %s", err)
+	}
+	if err := repo.RegisterNewProvider(prov); err != nil {
+		t.Fatalf("Registering the same provider twice is not expected to fail: %s", err)
+	}
+	clash := newNamedTestProv("prov", 20, 20)
+	if err := repo.RegisterNewProvider(clash); err == nil {
+		t.Fatalf("Expected a provider name clash to be rejected")
+	}
+	if got := repo.providerMap()["prov"]; got != prov {
+		t.Fatalf("Expected the original provider to be kept, got: %#v", got)
+	}
+
+	repo.RegisterProvider(clash)
+	if got := repo.providerMap()["prov"]; got != clash {
+		t.Fatalf("Expected RegisterProvider to replace the provider, got: %#v", got)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	repo := NewRepository()
+	prov1 := newNamedTestProv("prov1", 10, 10)
+	prov2 := newNamedTestProv("prov2", 20, 20)
+	repo.RegisterKey(NewKey("foo.bar"), prov1)
+	repo.RegisterKey(NewKey("foo.bar"), prov2)
+	repo.RegisterKey(NewKey("moo"), prov1)
+
+	type notification struct {
+		val Value
+		ok  bool
+	}
+	got := make(map[string][]notification)
+	subscribe := func(key string) func() {
+		return repo.Subscribe(NewKey(key), func(kv *KeyValue, ok bool) {
+			n := notification{ok: ok}
+			if ok {
+				n.val = kv.Value
+			}
+			got[key] = append(got[key], n)
+		})
+	}
+	subscribe("foo")
+	subscribe("foo.bar")
+	subscribe("moo")
+	cancel := subscribe("foo.bar")
+
+	prov2.val = 30
+	repo.ReportChange(prov2, NewKey("foo.bar"))
+	cancel()
+	repo.UnregisterProvider("prov2")
+	repo.UnregisterKey(NewKey("foo.bar"), prov1)
+
+	want := map[string][]notification{
+		"foo": {
+			{map[string]Value{"bar": 30}, true},
+			{map[string]Value{"bar": 10}, true},
+			{nil, false},
+		},
+		"foo.bar": {
+			{30, true},
+			{30, true},
+			{10, true},
+			{nil, false},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected notifications: got: %#v, want: %#v", got, want)
+	}
+}
+
+func TestSetUpDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		provs     map[string][]string
+		wantOrder []string
+		wantErr   error
+	}{
+		{
+			"Hard dependency",
+			map[string][]string{"yaml": {"cli"}, "cli": {}},
+			[]string{"cli", "yaml"},
+			nil,
+		},
+		{
+			"Soft dependency present",
+			map[string][]string{"yaml": {SoftDependency("cli")}, "cli": {}},
+			[]string{"cli", "yaml"},
+			nil,
+		},
+		{
+			"Soft dependency missing",
+			map[string][]string{"yaml": {SoftDependency("cli")}},
+			[]string{"yaml"},
+			nil,
+		},
+		{
+			"Provider type dependency",
+			map[string][]string{"yaml": {"env"}, "env:APP_": {}, "env:LEGACY_": {"env:APP_"}},
+			[]string{"env:APP_", "env:LEGACY_", "yaml"},
+			nil,
+		},
+		{
+			"Provider instance dependency missing",
+			map[string][]string{"yaml": {"env:APP_"}, "env:LEGACY_": {}},
+			[]string{},
+			&UnmetDependenciesError{
+				Unmet: []UnmetDependency{
+					{Provider: "yaml", Dependency: "env:APP_"},
+				},
+			},
+		},
+		{
+			"Hard dependencies missing",
+			map[string][]string{"yaml": {"env", "cli"}, "cli": {"default"}},
+			[]string{},
+			&UnmetDependenciesError{
+				Unmet: []UnmetDependency{
+					{Provider: "cli", Dependency: "default"},
+					{Provider: "yaml", Dependency: "env"},
+				},
+			},
+		},
+	}
+
+	t.Parallel()
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			repo := NewRepository()
+			log := make([]string, 0)
+			for name, deps := range testCase.provs {
+				repo.RegisterProvider(newHookTestProv(name, deps, logSetUp(&log, name)))
+			}
+			err := repo.SetUp()
+			if !reflect.DeepEqual(err, testCase.wantErr) {
+				t.Fatalf("Unexpected error: got: %v, want: %v", err, testCase.wantErr)
+			}
+			if !reflect.DeepEqual(log, testCase.wantOrder) {
+				t.Fatalf("Unexpected set up order: got: %v, want: %v", log, testCase.wantOrder)
+			}
+		})
+	}
+}
+
+func TestBuiltinDependencies(t *testing.T) {
+	// Redefining the original value
+	oldReadRaw := readRaw
+	defer func() { readRaw = oldReadRaw }()
+	readRaw = func(source string) (map[interface{}]interface{}, error) {
+		return map[interface{}]interface{}{}, nil
+	}
+
+	repo := NewRepository()
+	if _, err := NewYamlProvider(repo, 10); err != nil {
+		t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+	}
+	if _, err := NewEnvProvider(repo, 20); err != nil {
+		t.Fatalf("Failed to initialize a new env provider: %s", err)
+	}
+	// The config file location is read from the repo: cli is required
+	want := &UnmetDependenciesError{
+		Unmet: []UnmetDependency{
+			{Provider: "yaml", Dependency: "cli"},
+		},
+	}
+	if err := repo.SetUp(); !reflect.DeepEqual(err, want) {
+		t.Fatalf("Unexpected error: got: %v, want: %v", err, want)
+	}
+
+	// The explicit source does not need cli, the defaults are optional
+	repo = NewRepository()
+	if _, err := NewYamlProviderFromSource(repo, 10, &YamlProviderOptions{}, "dummy.dummy"); err != nil {
+		t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+	}
+	if _, err := NewEnvProvider(repo, 20); err != nil {
+		t.Fatalf("Failed to initialize a new env provider: %s", err)
+	}
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+}
+
+func TestProviderGraph(t *testing.T) {
+	repo := NewRepository()
+	log := make([]string, 0)
+	repo.RegisterProvider(newHookTestProv("default", []string{}, logSetUp(&log, "default")))
+	repo.RegisterProvider(newHookTestProv("cli", []string{SoftDependency("default")}, logSetUp(&log, "cli")))
+	repo.RegisterProvider(newHookTestProv("yaml", []string{"cli", SoftDependency("env")}, logSetUp(&log, "yaml")))
+
+	top, err := repo.ProviderGraph()
+	if err != nil {
+		t.Fatalf("Failed to build the provider graph: %s", err)
+	}
+	layers, err := top.Layers()
+	if err != nil {
+		t.Fatalf("Failed to build the provider graph layers: %s", err)
+	}
+	got := make([][]string, 0, len(layers))
+	for _, layer := range layers {
+		got = append(got, nodeNames(layer))
+	}
+	if want := [][]string{{"default"}, {"cli"}, {"yaml"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected provider graph layers: got: %v, want: %v", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+package config
+
+// ProviderRule restricts the providers allowed to serve the keys matching
+// the pattern (see RepositoryOptions.ProviderRules). The pattern is a key
+// which might contain `*` wildcard fragments matching any single fragment. A
+// pattern matches the key itself and all it's sub-keys: `db` covers
+// `db.password`.
+// The providers are referred to by type (e.g. env: all the env provider
+// instances) or by instance name (e.g. env:APP_).
+type ProviderRule struct {
+	Pattern string
+	// Pin is the list of the only providers allowed to serve the keys.
+	// Ignored if empty.
+	Pin []string
+	// Exclude is the list of the providers never serving the keys.
+	Exclude []string
+}
+
+// matches returns true if the pattern matches the key or any of it's parent
+// keys.
+func (r *ProviderRule) matches(key Key) bool {
+	pattern := NewKey(r.Pattern)
+	if len(pattern) > len(key) {
+		return false
+	}
+	for ix, k := range pattern {
+		if k != "*" && k != key[ix] {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleSchema is a schema marker produced by Pin() and Exclude().
+type ruleSchema struct {
+	schema  Schema
+	pin     []string
+	exclude []string
+}
+
+// Pin restricts the providers allowed to serve the schema node (including
+// all sub-keys) to the listed ones. The wrapped schema is defined as usual.
+//
+// Example:
+// schema := map[string]Schema{"db": map[string]Schema{"password": Pin(ToStr, "secrets")}}
+func Pin(s Schema, providers ...string) Schema {
+	return &ruleSchema{schema: s, pin: providers}
+}
+
+// Exclude prevents the listed providers from serving the schema node
+// (including all sub-keys). The wrapped schema is defined as usual.
+//
+// Example:
+// schema := map[string]Schema{"system": map[string]Schema{"maxprocs": Exclude(ToInt, "yaml")}}
+func Exclude(s Schema, providers ...string) Schema {
+	return &ruleSchema{schema: s, exclude: providers}
+}
+
+// providerRules collects the provider rules declared by the schema for the
+// key and all it's parent keys. Wildcards are respected the same way as in
+// `Find()`.
+func (mn *MapperNode) providerRules(key Key, res []ProviderRule) []ProviderRule {
+	if len(mn.Pin) > 0 || len(mn.Exclude) > 0 {
+		res = append(res, ProviderRule{Pin: mn.Pin, Exclude: mn.Exclude})
+	}
+	if len(key) == 0 {
+		return res
+	}
+	for _, nextK := range []string{key[0], "*"} {
+		if next, ok := mn.Children[nextK]; ok {
+			res = next.providerRules(key[1:], res)
+		}
+	}
+	return res
+}
+
+// allowsProvider checks the provider against the repository and the schema
+// rules applicable to the key: the provider must be listed by every
+// applicable pin and must not be listed by any applicable exclude.
+func (repo *Repository) allowsProvider(key Key, prov Provider) bool {
+	rules := repo.loadMappers().providerRules(key, nil)
+	for ix := range repo.options.ProviderRules {
+		if r := &repo.options.ProviderRules[ix]; r.matches(key) {
+			rules = append(rules, *r)
+		}
+	}
+	name := prov.Name()
+	for _, r := range rules {
+		if len(r.Pin) > 0 && !listsProvider(r.Pin, name) {
+			return false
+		}
+		if listsProvider(r.Exclude, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// keyProviders returns the providers allowed to serve the key, the order is
+// preserved.
+func (repo *Repository) keyProviders(key Key, providers []Provider) []Provider {
+	res := make([]Provider, 0, len(providers))
+	for _, prov := range providers {
+		if repo.allowsProvider(key, prov) {
+			res = append(res, prov)
+		}
+	}
+	return res
+}
+
+func listsProvider(list []string, name string) bool {
+	for _, ref := range list {
+		if satisfiesDependency(name, ref) {
+			return true
+		}
+	}
+	return false
+}
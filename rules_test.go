@@ -0,0 +1,86 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProviderRuleMatches(t *testing.T) {
+	rule := &ProviderRule{Pattern: "*.password"}
+	tests := map[string]bool{
+		"db.password":        true,
+		"cache.password.old": true,
+		"password":           false,
+		"db.user":            false,
+	}
+	for key, want := range tests {
+		if got := rule.matches(NewKey(key)); got != want {
+			t.Fatalf("Unexpected match result for key %q: got: %t, want: %t", key, got, want)
+		}
+	}
+}
+
+func TestProviderRules(t *testing.T) {
+	oldEnvVars := envVars
+	defer func() { envVars = oldEnvVars }()
+	envVars = func() []string {
+		return []string{"CONFIG_DB_PASSWORD=leaked", "CONFIG_DB_HOST=db.local", "CONFIG_CACHE_PASSWORD=leaked"}
+	}
+
+	repo := NewRepositoryWithOptions(&RepositoryOptions{
+		ProviderRules: []ProviderRule{
+			{Pattern: "*.password", Pin: []string{"default:secrets"}},
+		},
+	})
+	if err := repo.DefineSchema(map[string]Schema{
+		"system": map[string]Schema{
+			"maxprocs": Exclude(ToInt, "default:file"),
+		},
+	}); err != nil {
+		t.Fatalf("Failed to define the schema: %s", err)
+	}
+	if _, err := NewDefaultProviderWithDefaults(repo, 0, map[string]Value{"system.maxprocs": 4}); err != nil {
+		t.Fatalf("Failed to initialize a new default provider: %s", err)
+	}
+	if _, err := NewDefaultProviderWithOptions(repo, 10, &DefaultProviderOptions{
+		Instance: "file",
+		Defaults: map[string]Value{"system.maxprocs": 16},
+	}); err != nil {
+		t.Fatalf("Failed to initialize a new default provider: %s", err)
+	}
+	if _, err := NewDefaultProviderWithOptions(repo, 5, &DefaultProviderOptions{
+		Instance: "secrets",
+		Defaults: map[string]Value{"db.password": "s3cret"},
+	}); err != nil {
+		t.Fatalf("Failed to initialize a new default provider: %s", err)
+	}
+	if _, err := NewEnvProvider(repo, 20); err != nil {
+		t.Fatalf("Failed to initialize a new env provider: %s", err)
+	}
+	if err := repo.SetUp(); err != nil {
+		t.Fatalf("Failed to set up the repo: %s", err)
+	}
+
+	want := map[string]Value{
+		"system.maxprocs": 4,
+		"db.password":     "s3cret",
+		"db.host":         "db.local",
+	}
+	for k, v := range want {
+		if got, ok := repo.Get(NewKey(k)); !ok || got != v {
+			t.Fatalf("Unexpected value for key %q: got: %#v, want: %#v", k, got, v)
+		}
+	}
+	if got, ok := repo.Get(NewKey("cache.password")); ok {
+		t.Fatalf("Expected no value for a key served by excluded providers only, got: %#v", got)
+	}
+	if got, ok := repo.Get(NewKey("db")); !ok || !reflect.DeepEqual(got, map[string]Value{"password": "s3cret", "host": "db.local"}) {
+		t.Fatalf("Unexpected value for key %q: got: %#v", "db", got)
+	}
+
+	system := repo.Explain()["system"].(map[string]interface{})
+	maxprocs := system["maxprocs"].(map[string]interface{})["__value__"].([]map[string]interface{})
+	if maxprocs[0]["provider_name"] != "default:file" || maxprocs[0]["excluded"] != true {
+		t.Fatalf("Expected the excluded provider to be marked in explain output: %#v", maxprocs)
+	}
+}
@@ -6,3 +6,18 @@ package config
 // * a Converter
 // * a map[string]Schema
 type Schema interface{}
+
+type describedSchema struct {
+	schema Schema
+	descr  string
+}
+
+// Describe attaches a human-readable description to a schema node. The
+// wrapped schema is defined as usual. The description is shown in the
+// generated usage (see CliProvider.WriteUsage).
+//
+// Example:
+// schema := map[string]Schema{"system": map[string]Schema{"maxprocs": Describe(ToInt, "Max number of OS threads")}}
+func Describe(s Schema, descr string) Schema {
+	return &describedSchema{schema: s, descr: descr}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Redacted is the placeholder printed instead of a secret value.
+const Redacted = "******"
+
+// SecretValue wraps a sensitive value. It never reveals the wrapped value
+// when formatted with fmt, marshaled to JSON or YAML: all of these produce
+// the Redacted placeholder instead. The original value is only accessible
+// with Reveal().
+//
+// Providers might return values wrapped in SecretValue. The repository unwraps
+// them before mapping, so `repo.Get` always returns the real value.
+type SecretValue struct {
+	value Value
+}
+
+var _ fmt.Formatter = SecretValue{}
+var _ json.Marshaler = SecretValue{}
+
+// NewSecretValue wraps the value into a SecretValue.
+func NewSecretValue(v Value) SecretValue {
+	return SecretValue{value: v}
+}
+
+// Reveal returns the original wrapped value.
+func (s SecretValue) Reveal() Value { return s.value }
+
+// String satisfies Stringer interface. Returns the Redacted placeholder.
+func (s SecretValue) String() string { return Redacted }
+
+// GoString satisfies GoStringer interface. Returns the Redacted placeholder.
+func (s SecretValue) GoString() string { return Redacted }
+
+// Format satisfies fmt.Formatter interface: all verbs print the Redacted
+// placeholder.
+func (s SecretValue) Format(f fmt.State, verb rune) {
+	if verb == 'q' {
+		fmt.Fprintf(f, "%q", Redacted)
+		return
+	}
+	fmt.Fprint(f, Redacted)
+}
+
+// MarshalJSON satisfies json.Marshaler interface.
+func (s SecretValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Redacted)
+}
+
+// MarshalYAML satisfies yaml.Marshaler interface.
+func (s SecretValue) MarshalYAML() (interface{}, error) {
+	return Redacted, nil
+}
+
+// unwrapSecret returns the original value and true if the argument is a
+// SecretValue. Returns the argument itself and false otherwise.
+func unwrapSecret(v Value) (Value, bool) {
+	if sv, ok := v.(SecretValue); ok {
+		return sv.value, true
+	}
+	if sv, ok := v.(*SecretValue); ok && sv != nil {
+		return sv.value, true
+	}
+	return v, false
+}
+
+// SecretProvider is an optional interface for providers serving sensitive
+// values exclusively (e.g. a secrets directory provider). If Secret() returns
+// true, every value served by the provider is redacted in `Explain` and `Dump`.
+type SecretProvider interface {
+	Secret() bool
+}
+
+func isSecretProvider(prov Provider) bool {
+	if sp, ok := prov.(SecretProvider); ok {
+		return sp.Secret()
+	}
+	return false
+}
+
+// secretSchema is a schema marker produced by Secret().
+type secretSchema struct {
+	schema Schema
+}
+
+// Secret marks a schema node as sensitive. The wrapped schema is defined as
+// usual, and the values of the key and all its sub-keys are redacted in
+// `Explain`, `Dump` and mapping errors.
+//
+// Example:
+// schema := map[string]Schema{"db": map[string]Schema{"password": Secret(ToStr)}}
+func Secret(s Schema) Schema {
+	return &secretSchema{schema: s}
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+type TestSecretProv struct {
+	*TestProv
+}
+
+func (tsp *TestSecretProv) Name() string { return "secret" }
+func (tsp *TestSecretProv) Secret() bool { return true }
+
+func TestSecretValueFormat(t *testing.T) {
+	sv := NewSecretValue("p4ssw0rd")
+	tests := []struct {
+		name   string
+		format string
+		want   string
+	}{
+		{"%v", "%v", Redacted},
+		{"%+v", "%+v", Redacted},
+		{"%#v", "%#v", Redacted},
+		{"%s", "%s", Redacted},
+		{"%q", "%q", fmt.Sprintf("%q", Redacted)},
+		{"%d", "%d", Redacted},
+		{"nested in a map", "%v", "map[password:" + Redacted + "]"},
+	}
+
+	t.Parallel()
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			var got string
+			if testCase.name == "nested in a map" {
+				got = fmt.Sprintf(testCase.format, map[string]Value{"password": sv})
+			} else {
+				got = fmt.Sprintf(testCase.format, sv)
+			}
+			if got != testCase.want {
+				t.Fatalf("Unexpected formatted secret: got: %q, want: %q", got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestSecretValueMarshal(t *testing.T) {
+	sv := NewSecretValue("p4ssw0rd")
+
+	jsonData, err := json.Marshal(map[string]Value{"password": sv})
+	if err != nil {
+		t.Fatalf("Failed to marshal a secret to json: %s", err)
+	}
+	if strings.Contains(string(jsonData), "p4ssw0rd") {
+		t.Fatalf("Json representation reveals the secret: %s", jsonData)
+	}
+
+	yamlData, err := yaml.Marshal(map[string]Value{"password": sv})
+	if err != nil {
+		t.Fatalf("Failed to marshal a secret to yaml: %s", err)
+	}
+	if strings.Contains(string(yamlData), "p4ssw0rd") {
+		t.Fatalf("Yaml representation reveals the secret: %s", yamlData)
+	}
+
+	if got := sv.Reveal(); got != "p4ssw0rd" {
+		t.Fatalf("Unexpected revealed value: got: %#v, want: %#v", got, "p4ssw0rd")
+	}
+}
+
+func TestSecretSchema(t *testing.T) {
+	repo := NewRepository()
+	if err := repo.DefineSchema(map[string]Schema{
+		"db": map[string]Schema{
+			"password": Secret(ToStr),
+			"port":     ToInt,
+		},
+		"tokens": Secret(nil),
+	}); err != nil {
+		t.Fatalf("Failed to define schema: %s", err)
+	}
+	repo.RegisterKey(NewKey("db.password"), NewTestProv(42, 10))
+	repo.RegisterKey(NewKey("db.port"), NewTestProv("5432", 10))
+	repo.RegisterKey(NewKey("tokens.api"), NewTestProv("t0k3n", 10))
+
+	for key, want := range map[string]Value{
+		"db.password": "42",
+		"db.port":     5432,
+		"tokens.api":  "t0k3n",
+	} {
+		got, ok := repo.Get(NewKey(key))
+		if !ok {
+			t.Fatalf("Expected lookup for key %q to find a value, none returned", key)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Unexpected value for key %q: got: %#v, want: %#v", key, got, want)
+		}
+	}
+
+	wantDump := map[string]Value{
+		"db.password": NewSecretValue("42"),
+		"db.port":     5432,
+		"tokens.api":  NewSecretValue("t0k3n"),
+	}
+	if gotDump := repo.Dump(); !reflect.DeepEqual(gotDump, wantDump) {
+		t.Fatalf("Unexpected repo.Dump(): got: %#v, want: %#v", gotDump, wantDump)
+	}
+
+	explain := fmt.Sprintf("%v", repo.Explain())
+	for _, secret := range []string{"42", "t0k3n"} {
+		if strings.Contains(explain, secret) {
+			t.Fatalf("repo.Explain() reveals secret %q: %s", secret, explain)
+		}
+	}
+	if !strings.Contains(explain, "5432") {
+		t.Fatalf("repo.Explain() is expected to reveal non-secret values: %s", explain)
+	}
+}
+
+func TestSecretProvider(t *testing.T) {
+	repo := NewRepository()
+	repo.DefineSchema(map[string]Schema{
+		"db": map[string]Schema{
+			"password": ToStr,
+		},
+	})
+	prov := &TestSecretProv{NewTestProv("p4ssw0rd", 20)}
+	repo.RegisterKey(NewKey("db.password"), prov)
+	repo.RegisterKey(NewKey("db.password"), NewTestProv("0ld", 10))
+
+	if got, ok := repo.Get(NewKey("db.password")); !ok || got != "p4ssw0rd" {
+		t.Fatalf("Unexpected lookup result: got: %#v, %t, want: %#v, true", got, ok, "p4ssw0rd")
+	}
+
+	explain := fmt.Sprintf("%#v", repo.Explain())
+	if strings.Contains(explain, "p4ssw0rd") {
+		t.Fatalf("repo.Explain() reveals the secret: %s", explain)
+	}
+	if !strings.Contains(explain, "0ld") {
+		t.Fatalf("repo.Explain() is expected to reveal non-secret provider values: %s", explain)
+	}
+}
+
+func TestSecretValueFromProvider(t *testing.T) {
+	repo := NewRepository()
+	repo.DefineSchema(map[string]Schema{
+		"db": map[string]Schema{
+			"port": ToInt,
+		},
+	})
+	repo.RegisterKey(NewKey("db.port"), NewTestProv(NewSecretValue("5432"), 10))
+
+	if got, ok := repo.Get(NewKey("db.port")); !ok || got != 5432 {
+		t.Fatalf("Unexpected lookup result: got: %#v, %t, want: %#v, true", got, ok, 5432)
+	}
+	want := map[string]Value{"db.port": NewSecretValue(5432)}
+	if got := repo.Dump(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected repo.Dump(): got: %#v, want: %#v", got, want)
+	}
+}
+
+func TestSecretMappingError(t *testing.T) {
+	repo := NewRepository()
+	repo.DefineSchema(map[string]Schema{
+		"db": map[string]Schema{
+			"password": Secret(ToInt),
+		},
+	})
+	repo.RegisterKey(NewKey("db.password"), NewTestProv("p4ssw0rd", 10))
+
+	_, _, err := repo.resolve(context.Background(), repo.loadRoot().find(NewKey("db.password")).providers[0], NewKey("db.password"))
+	if err == nil {
+		t.Fatalf("Expected a mapping error, got nil")
+	}
+	if strings.Contains(err.Error(), "p4ssw0rd") {
+		t.Fatalf("Mapping error reveals the secret: %s", err)
+	}
+}
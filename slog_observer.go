@@ -0,0 +1,49 @@
+//go:build go1.21
+// +build go1.21
+
+package config
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogObserver writes the events to a structured logger.
+type slogObserver struct {
+	logger *slog.Logger
+}
+
+// NewSlogObserver returns an Observer writing every event to the structured
+// logger. Failures are logged at the error level, key registrations at the
+// debug level and everything else at the info level. If the logger is nil,
+// slog.Default() is used.
+func NewSlogObserver(logger *slog.Logger) Observer {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &slogObserver{logger: logger}
+}
+
+func (so *slogObserver) Observe(e Event) {
+	level := slog.LevelInfo
+	switch {
+	case e.Failed():
+		level = slog.LevelError
+	case e.Type == EventKeyRegistered:
+		level = slog.LevelDebug
+	}
+	attrs := []slog.Attr{slog.String("event", e.Type.String())}
+	if len(e.Provider) > 0 {
+		attrs = append(attrs, slog.String("provider", e.Provider))
+	}
+	if len(e.Key) > 0 {
+		attrs = append(attrs, slog.String("key", e.Key.String()))
+	}
+	if e.Duration > 0 {
+		attrs = append(attrs, slog.Duration("duration", e.Duration))
+	}
+	if e.Err != nil {
+		attrs = append(attrs, slog.String("error", e.Err.Error()))
+	}
+	so.logger.LogAttrs(context.Background(), level, "config event", attrs...)
+}
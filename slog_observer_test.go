@@ -0,0 +1,38 @@
+//go:build go1.21
+// +build go1.21
+
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogObserver(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey && len(groups) == 0 {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	obs := NewSlogObserver(logger)
+	obs.Observe(Event{Type: EventKeyRegistered, Provider: "env", Key: NewKey("system.maxprocs")})
+	obs.Observe(Event{Type: EventSetUp, Provider: "env"})
+	obs.Observe(Event{Type: EventReloadFailed, Provider: "yaml", Err: fmt.Errorf("file not found")})
+
+	want := strings.Join([]string{
+		`level=INFO msg="config event" event=setup provider=env`,
+		`level=ERROR msg="config event" event=reload_failed provider=yaml error="file not found"`,
+		``,
+	}, "\n")
+	if got := buf.String(); got != want {
+		t.Fatalf("Unexpected log output: got: %q, want: %q", got, want)
+	}
+}
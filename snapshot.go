@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"time"
+)
+
+// Snapshot is an immutable view of all the repository values taken at one
+// point in time. Unlike `Repository.Get`, which resolves every key
+// independently, all values in a snapshot belong to the same repository
+// generation, therefore related keys (e.g. host and port) are guaranteed to
+// be consistent with each other.
+// Values returned by a snapshot are shared between the callers and must not
+// be modified.
+type Snapshot struct {
+	repo       *Repository
+	generation uint64
+	values     map[string]Value
+}
+
+// snapshotAttempts is the number of optimistic snapshot collection attempts
+// before falling back to the exclusive one.
+const snapshotAttempts = 8
+
+// snapshotBackoff is the delay before the second collection attempt. It is
+// doubled on every further attempt.
+const snapshotBackoff = 50 * time.Microsecond
+
+// Snapshot returns a consistent view of all the repository values.
+// The values are collected optimistically: if the repository generation
+// changed while the values were being collected (a key registration or a
+// provider-reported change took place), the collection is repeated after a
+// short delay. If the repository keeps changing, the values are collected
+// with the provider state replacements (see Repository.Change) locked out.
+// The snapshot consistency is only guaranteed for the providers replacing
+// their state with Repository.Change (the yaml provider reload does): the
+// values of a provider changing them otherwise might come from different
+// generations.
+func (repo *Repository) Snapshot() *Snapshot {
+	delay := snapshotBackoff
+	for attempt := 0; attempt < snapshotAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		gen := repo.Generation()
+		values := make(map[string]Value)
+		repo.loadRoot().collect(repo, nil, values)
+		if repo.Generation() == gen {
+			return &Snapshot{
+				repo:       repo,
+				generation: gen,
+				values:     values,
+			}
+		}
+	}
+	repo.changeMx.Lock()
+	defer repo.changeMx.Unlock()
+	gen := repo.Generation()
+	values := make(map[string]Value)
+	repo.loadRoot().collect(repo, nil, values)
+	return &Snapshot{
+		repo:       repo,
+		generation: gen,
+		values:     values,
+	}
+}
+
+// collect resolves the node value (including all sub-keys) and stores
+// it in values under the flattened key.
+func (n *node) collect(repo *Repository, key Key, values map[string]Value) (Value, bool) {
+	if strategy := repo.mergeStrategy(key); strategy != MergeReplace {
+		mkv, _, ok, err := repo.resolveMerged(context.Background(), n, key, strategy)
+		if err != nil {
+			panic(err)
+		}
+		// The sub-keys are looked up individually the same way repo.Get
+		// does
+		for k, ch := range n.children {
+			ch.collect(repo, key.child(k), values)
+		}
+		if ok {
+			values[key.String()] = mkv.Value
+			return mkv.Value, true
+		}
+		return nil, false
+	}
+	if n.preferLeaf(repo, key) {
+		// The sub-keys are looked up individually the same way repo.Get
+		// does
+		for k, ch := range n.children {
+			ch.collect(repo, key.child(k), values)
+		}
+		for _, prov := range repo.keyProviders(key, n.providers) {
+			mkv, ok, err := repo.resolve(context.Background(), prov, key)
+			if err != nil {
+				panic(err)
+			}
+			if ok {
+				values[key.String()] = mkv.Value
+				return mkv.Value, true
+			}
+		}
+		return nil, false
+	}
+	res := make(map[string]Value)
+	for k, ch := range n.children {
+		if v, ok := ch.collect(repo, key.child(k), values); ok {
+			res[k] = v
+		}
+	}
+	// The root node is protected and has no value
+	if len(key) == 0 {
+		return nil, false
+	}
+	mkv, err := repo.doMap(&KeyValue{Key: key, Value: assemble(res)})
+	if err != nil {
+		panic(err)
+	}
+	values[key.String()] = mkv.Value
+	return mkv.Value, true
+}
+
+// Get returns the value stored in the snapshot and a bool flag indicating the
+// lookup result. Mimics `Repository.Get`.
+func (s *Snapshot) Get(key Key) (Value, bool) {
+	if len(key) == 0 {
+		return nil, false
+	}
+	v, ok := s.values[key.String()]
+	return v, ok
+}
+
+// Generation returns the repository generation the snapshot was taken at.
+func (s *Snapshot) Generation() uint64 {
+	return s.generation
+}
+
+// Stale returns true if the repository generation has changed since the
+// snapshot was taken. A stale snapshot stays consistent, but it might not
+// reflect the most recent config values.
+func (s *Snapshot) Stale() bool {
+	return s.repo.Generation() != s.generation
+}
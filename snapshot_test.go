@@ -0,0 +1,201 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestReloadProv emulates a provider reloading its values concurrently with
+// a reader: the first lookup triggers a reload.
+type TestReloadProv struct {
+	repo     *Repository
+	registry map[string]Value
+	next     map[string]Value
+}
+
+func (trp *TestReloadProv) SetUp(_ *Repository) error    { return nil }
+func (trp *TestReloadProv) TearDown(_ *Repository) error { return nil }
+func (trp *TestReloadProv) Weight() int                  { return 10 }
+func (trp *TestReloadProv) Name() string                 { return "reload" }
+func (trp *TestReloadProv) Depends() []string            { return []string{} }
+
+func (trp *TestReloadProv) Get(key Key) (*KeyValue, bool) {
+	val, ok := trp.registry[key.String()]
+	if trp.next != nil {
+		trp.registry, trp.next = trp.next, nil
+		trp.repo.ReportChange(trp)
+	}
+	if !ok {
+		return nil, false
+	}
+	return &KeyValue{Key: key, Value: val}, true
+}
+
+func TestSnapshotGet(t *testing.T) {
+	repo := NewRepository()
+	repo.DefineSchema(map[string]Schema{
+		"db": map[string]Schema{
+			"port": ToInt,
+		},
+	})
+	repo.RegisterKey(NewKey("db.host"), NewTestProv("localhost", 10))
+	repo.RegisterKey(NewKey("db.port"), NewTestProv("5432", 10))
+
+	snap := repo.Snapshot()
+
+	tests := []struct {
+		key Key
+		ok  bool
+		val Value
+	}{
+		{
+			key: NewKey("db"),
+			ok:  true,
+			val: map[string]Value{"host": "localhost", "port": 5432},
+		},
+		{
+			key: NewKey("db.host"),
+			ok:  true,
+			val: "localhost",
+		},
+		{
+			key: NewKey("db.port"),
+			ok:  true,
+			val: 5432,
+		},
+		{
+			key: NewKey(""),
+			ok:  false,
+			val: nil,
+		},
+		{
+			key: NewKey("db.user"),
+			ok:  false,
+			val: nil,
+		},
+	}
+
+	for _, testCase := range tests {
+		val, ok := snap.Get(testCase.key)
+		if ok != testCase.ok {
+			t.Fatalf("Unexpected key %q lookup result: want %t, got: %t", testCase.key, testCase.ok, ok)
+		}
+		if !reflect.DeepEqual(val, testCase.val) {
+			t.Fatalf("Unexpected value for key %q: want %#v, got %#v", testCase.key, testCase.val, val)
+		}
+		repoVal, repoOk := repo.Get(testCase.key)
+		if repoOk != ok || !reflect.DeepEqual(repoVal, val) {
+			t.Fatalf("Snapshot lookup for key %q diverges from the repo: got: %#v, want: %#v", testCase.key, val, repoVal)
+		}
+	}
+}
+
+func TestSnapshotStale(t *testing.T) {
+	repo := NewRepository()
+	prov := NewTestProv("localhost", 10)
+	repo.RegisterKey(NewKey("db.host"), prov)
+
+	snap := repo.Snapshot()
+	if snap.Generation() != repo.Generation() {
+		t.Fatalf("Unexpected snapshot generation: got: %d, want: %d", snap.Generation(), repo.Generation())
+	}
+	if snap.Stale() {
+		t.Fatalf("A fresh snapshot is not expected to be stale")
+	}
+
+	repo.ReportChange(prov, NewKey("db.host"))
+	if !snap.Stale() {
+		t.Fatalf("Snapshot is expected to be stale after a reported change")
+	}
+
+	snap = repo.Snapshot()
+	repo.RegisterKey(NewKey("db.port"), prov)
+	if !snap.Stale() {
+		t.Fatalf("Snapshot is expected to be stale after a key registration")
+	}
+	if _, ok := snap.Get(NewKey("db.port")); ok {
+		t.Fatalf("Snapshot is expected to be immutable")
+	}
+}
+
+func TestSnapshotConsistency(t *testing.T) {
+	repo := NewRepository()
+	prov := &TestReloadProv{
+		repo:     repo,
+		registry: map[string]Value{"db.host": "old.host", "db.port": 1},
+		next:     map[string]Value{"db.host": "new.host", "db.port": 2},
+	}
+	repo.RegisterKey(NewKey("db.host"), prov)
+	repo.RegisterKey(NewKey("db.port"), prov)
+
+	snap := repo.Snapshot()
+	want := map[string]Value{"host": "new.host", "port": 2}
+	if got, _ := snap.Get(NewKey("db")); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected snapshot value: got: %#v, want: %#v", got, want)
+	}
+	if snap.Stale() {
+		t.Fatalf("Snapshot is not expected to be stale")
+	}
+}
+
+func TestSnapshotMerge(t *testing.T) {
+	repo := NewRepository()
+	repo.DefineSchema(map[string]Schema{
+		"db": Merge(map[string]Schema{
+			"port": ToInt,
+		}, MergeAppend),
+	})
+	repo.RegisterKey(NewKey("db.host"), newNamedTestProv("host", "localhost", 10))
+	repo.RegisterKey(NewKey("db.port"), newNamedTestProv("port", "5432", 20))
+
+	snap := repo.Snapshot()
+	for _, k := range []string{"db", "db.host", "db.port"} {
+		key := NewKey(k)
+		val, ok := snap.Get(key)
+		repoVal, repoOk := repo.Get(key)
+		if !ok || !repoOk || !reflect.DeepEqual(val, repoVal) {
+			t.Fatalf("Snapshot lookup for key %q diverges from the repo: got: %#v, want: %#v", key, val, repoVal)
+		}
+	}
+}
+
+// TestChangingProv reports a change on every lookup.
+type TestChangingProv struct {
+	*TestProv
+	repo *Repository
+}
+
+func (tcp *TestChangingProv) Get(key Key) (*KeyValue, bool) {
+	tcp.repo.ReportChange(tcp, key)
+	return tcp.TestProv.Get(key)
+}
+
+func TestSnapshotChanging(t *testing.T) {
+	repo := NewRepository()
+	prov := &TestChangingProv{TestProv: NewTestProv("localhost", 10), repo: repo}
+	repo.RegisterKey(NewKey("db.host"), prov)
+
+	// The optimistic collection never succeeds: the snapshot is expected to
+	// fall back to the exclusive one
+	snap := repo.Snapshot()
+	if got, ok := snap.Get(NewKey("db.host")); !ok || got != "localhost" {
+		t.Fatalf("Unexpected snapshot value: got: %#v, %t", got, ok)
+	}
+}
+
+func TestRepositoryChange(t *testing.T) {
+	repo := NewRepository()
+	before := repo.Generation()
+	var during uint64
+	repo.Change(func() {
+		during = repo.Generation()
+	})
+	// A snapshot started before the change as well as the one started
+	// during the change must notice it
+	if during == before {
+		t.Fatalf("Expected the generation to change before the state replacement")
+	}
+	if repo.Generation() == during {
+		t.Fatalf("Expected the generation to change after the state replacement")
+	}
+}
@@ -1,7 +1,12 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 type TopologyNode interface{}
@@ -44,27 +49,27 @@ func (top *Topology) AddNode(node TopologyNode) {
 // dependencies.
 func (top *Topology) Connect(from, to TopologyNode) error {
 	if _, ok := top.Nodes[from]; !ok {
-		return fmt.Errorf("Can not connect from unknown node: %#v", from)
+		return fmt.Errorf("Can not connect from unknown node: %s", NodeName(from))
 	}
 	if _, ok := top.Nodes[to]; !ok {
-		return fmt.Errorf("Can not connect to unknown node: %#v", to)
+		return fmt.Errorf("Can not connect to unknown node: %s", NodeName(to))
 	}
 	top.Edges[TopologyEdge{From: from, To: to}] = struct{}{}
 
 	return nil
 }
 
+// Sort returns the topologically sorted list of nodes: every node goes after
+// all the nodes it depends on. The order is deterministic: independent nodes
+// are ordered by name and weight (see NodeName and NodeWeight).
+// Returns CycleError if the graph contains a cycle.
 func (top *Topology) Sort() ([]TopologyNode, error) {
 	temp := make(map[TopologyNode]bool)
 	perm := make(map[TopologyNode]bool)
-	outs := make(map[TopologyNode][]TopologyNode)
-	for edge := range top.Edges {
-		if _, ok := outs[edge.From]; !ok {
-			outs[edge.From] = make([]TopologyNode, 0, 1)
-		}
-		outs[edge.From] = append(outs[edge.From], edge.To)
-	}
+	outs := top.outs()
 
+	// stack keeps the current DFS path for cycle reporting
+	stack := make([]TopologyNode, 0)
 	var visitAll func([]TopologyNode) ([]TopologyNode, error)
 	visitAll = func(nodes []TopologyNode) ([]TopologyNode, error) {
 		res := make([]TopologyNode, 0)
@@ -73,9 +78,16 @@ func (top *Topology) Sort() ([]TopologyNode, error) {
 				continue
 			}
 			if temp[node] {
-				return nil, fmt.Errorf("Detected graph cycle on node %#v", node)
+				for ix, n := range stack {
+					if n == node {
+						path := make([]TopologyNode, 0, len(stack)-ix+1)
+						path = append(path, stack[ix:]...)
+						return nil, &CycleError{Path: append(path, node)}
+					}
+				}
 			}
 			temp[node] = true
+			stack = append(stack, node)
 			if subs, ok := outs[node]; ok {
 				subsorted, err := visitAll(subs)
 				if err != nil {
@@ -83,19 +95,166 @@ func (top *Topology) Sort() ([]TopologyNode, error) {
 				}
 				res = append(res, subsorted...)
 			}
+			stack = stack[:len(stack)-1]
 			perm[node] = true
 			res = append(res, node)
 		}
 		return res, nil
 	}
+
+	if res, err := visitAll(top.sortedNodes()); err != nil {
+		return nil, err
+	} else {
+		return res, nil
+	}
+}
+
+// outs returns the sorted list of outgoing connections for every node.
+func (top *Topology) outs() map[TopologyNode][]TopologyNode {
+	outs := make(map[TopologyNode][]TopologyNode)
+	for edge := range top.Edges {
+		outs[edge.From] = append(outs[edge.From], edge.To)
+	}
+	for _, tos := range outs {
+		sortNodes(tos)
+	}
+	return outs
+}
+
+// sortedNodes returns the list of nodes in a deterministic order.
+func (top *Topology) sortedNodes() []TopologyNode {
 	nodes := make([]TopologyNode, 0, len(top.Nodes))
 	for node := range top.Nodes {
 		nodes = append(nodes, node)
 	}
+	sortNodes(nodes)
+	return nodes
+}
+
+func sortNodes(nodes []TopologyNode) {
+	sort.SliceStable(nodes, func(a, b int) bool {
+		nameA, nameB := NodeName(nodes[a]), NodeName(nodes[b])
+		if nameA != nameB {
+			return nameA < nameB
+		}
+		return NodeWeight(nodes[a]) > NodeWeight(nodes[b])
+	})
+}
+
+// NodeName returns a human-readable name of the node. The name is defined by
+// the first method implemented by the node: `Name()`, `GetName()` or
+// `String()`. Falls back to the default fmt formatting.
+func NodeName(node TopologyNode) string {
+	switch n := node.(type) {
+	case interface{ Name() string }:
+		return n.Name()
+	case interface{ GetName() string }:
+		return n.GetName()
+	case fmt.Stringer:
+		return n.String()
+	}
+	return fmt.Sprintf("%v", node)
+}
 
-	if res, err := visitAll(nodes); err != nil {
+// NodeWeight returns the node weight if the node implements `Weight()`
+// method (e.g. a Provider). Returns 0 otherwise.
+func NodeWeight(node TopologyNode) int {
+	if n, ok := node.(interface{ Weight() int }); ok {
+		return n.Weight()
+	}
+	return 0
+}
+
+// CycleError is returned by Sort if the graph contains a cycle. The path
+// starts and ends with the same node.
+type CycleError struct {
+	Path []TopologyNode
+}
+
+func (e *CycleError) Error() string {
+	names := make([]string, 0, len(e.Path))
+	for _, node := range e.Path {
+		names = append(names, NodeName(node))
+	}
+	return fmt.Sprintf("Detected graph cycle: %s", strings.Join(names, " -> "))
+}
+
+// Reverse returns a new topology with the same nodes and all edges
+// flipped. If the original topology represents a dependency graph, the
+// reversed one represents a dependant graph: e.g. a sorted reversed topology
+// defines the teardown order.
+func (top *Topology) Reverse() *Topology {
+	rev := NewTopology()
+	for node := range top.Nodes {
+		rev.AddNode(node)
+	}
+	for edge := range top.Edges {
+		rev.Edges[TopologyEdge{From: edge.To, To: edge.From}] = struct{}{}
+	}
+	return rev
+}
+
+// Layers groups the nodes by the dependency depth. The first layer contains
+// the nodes with no outgoing connections (no dependencies), every next layer
+// contains the nodes depending on the previous layers only. A node is placed
+// in the lowest layer possible, therefore the nodes within a layer are
+// independent from each other. Nodes within a layer are sorted the same way
+// as in Sort.
+// Returns CycleError if the graph contains a cycle.
+func (top *Topology) Layers() ([][]TopologyNode, error) {
+	sorted, err := top.Sort()
+	if err != nil {
 		return nil, err
-	} else {
-		return res, nil
 	}
+	outs := top.outs()
+	depth := make(map[TopologyNode]int, len(sorted))
+	layers := make([][]TopologyNode, 0)
+	// Sort guarantees dependencies go first
+	for _, node := range sorted {
+		d := 0
+		for _, dep := range outs[node] {
+			if depth[dep]+1 > d {
+				d = depth[dep] + 1
+			}
+		}
+		depth[node] = d
+		if d == len(layers) {
+			layers = append(layers, make([]TopologyNode, 0, 1))
+		}
+		layers[d] = append(layers[d], node)
+	}
+	for _, layer := range layers {
+		sortNodes(layer)
+	}
+	return layers, nil
+}
+
+// WriteDOT writes the topology in Graphviz DOT format. Nodes are identified
+// by their names (see NodeName); the nodes of the same layer (see Layers) are
+// ranked equally. The output is deterministic.
+// Returns an error if the graph contains a cycle or the writer fails.
+func (top *Topology) WriteDOT(w io.Writer) error {
+	layers, err := top.Layers()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	buf.WriteString("digraph topology {\n")
+	buf.WriteString("\trankdir=BT;\n")
+	for _, layer := range layers {
+		names := make([]string, 0, len(layer))
+		for _, node := range layer {
+			names = append(names, strconv.Quote(NodeName(node)))
+		}
+		fmt.Fprintf(&buf, "\t{ rank=same; %s; }\n", strings.Join(names, "; "))
+	}
+	outs := top.outs()
+	for _, node := range top.sortedNodes() {
+		for _, dep := range outs[node] {
+			fmt.Fprintf(&buf, "\t%s -> %s;\n", strconv.Quote(NodeName(node)), strconv.Quote(NodeName(dep)))
+		}
+	}
+	buf.WriteString("}\n")
+	_, err = w.Write(buf.Bytes())
+	return err
 }
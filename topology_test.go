@@ -137,3 +137,159 @@ func TestTopology_SortExample(t *testing.T) {
 		visited[node.(StringerNode)] = true
 	}
 }
+
+func TestTopology_SortDeterministic(t *testing.T) {
+	nodes := []TopologyNode{
+		newTestNode("yaml"),
+		newTestNode("env"),
+		newTestNode("cli"),
+		newTestNode("default"),
+		newTestNode("plugin"),
+	}
+	top := NewTopology(nodes...)
+	top.Connect(nodes[0], nodes[1])
+	top.Connect(nodes[0], nodes[2])
+	top.Connect(nodes[1], nodes[3])
+	top.Connect(nodes[2], nodes[3])
+
+	want := []string{"default", "cli", "env", "plugin", "yaml"}
+	for i := 0; i < 20; i++ {
+		sorted, err := top.Sort()
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		got := make([]string, 0, len(sorted))
+		for _, node := range sorted {
+			got = append(got, NodeName(node))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Unexpected sort order: got: %v, want: %v", got, want)
+		}
+	}
+}
+
+type weightedTestNode struct {
+	name   string
+	weight int
+}
+
+func (wtn *weightedTestNode) Name() string { return wtn.name }
+func (wtn *weightedTestNode) Weight() int  { return wtn.weight }
+
+func TestTopology_SortTieBreakByWeight(t *testing.T) {
+	light, heavy := &weightedTestNode{"env", 10}, &weightedTestNode{"env", 20}
+	top := NewTopology(light, heavy)
+	sorted, err := top.Sort()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if want := []TopologyNode{heavy, light}; !reflect.DeepEqual(sorted, want) {
+		t.Fatalf("Unexpected sort order: got: %v, want: %v", sorted, want)
+	}
+}
+
+func TestTopology_SortCyclePath(t *testing.T) {
+	nodes := []TopologyNode{
+		newTestNode("default"),
+		newTestNode("yaml"),
+		newTestNode("cli"),
+		newTestNode("env"),
+	}
+	top := NewTopology(nodes...)
+	top.Connect(nodes[1], nodes[2])
+	top.Connect(nodes[2], nodes[3])
+	top.Connect(nodes[3], nodes[1])
+	top.Connect(nodes[3], nodes[0])
+
+	_, err := top.Sort()
+	cerr, ok := err.(*CycleError)
+	if !ok {
+		t.Fatalf("Expected a CycleError, got: %#v", err)
+	}
+	if want := []TopologyNode{nodes[2], nodes[3], nodes[1], nodes[2]}; !reflect.DeepEqual(cerr.Path, want) {
+		t.Fatalf("Unexpected cycle path: %s", cerr)
+	}
+	if want := "Detected graph cycle: cli -> env -> yaml -> cli"; cerr.Error() != want {
+		t.Fatalf("Unexpected error message: got: %q, want: %q", cerr.Error(), want)
+	}
+}
+
+func nodeNames(nodes []TopologyNode) []string {
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, NodeName(node))
+	}
+	return names
+}
+
+func TestTopology_Layers(t *testing.T) {
+	def, cli, env, yaml, plugin := newTestNode("default"), newTestNode("cli"), newTestNode("env"), newTestNode("yaml"), newTestNode("plugin")
+	top := NewTopology(def, cli, env, yaml, plugin)
+	top.Connect(cli, def)
+	top.Connect(env, def)
+	top.Connect(yaml, cli)
+	top.Connect(yaml, env)
+	top.Connect(yaml, def)
+
+	layers, err := top.Layers()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	got := make([][]string, 0, len(layers))
+	for _, layer := range layers {
+		got = append(got, nodeNames(layer))
+	}
+	want := [][]string{{"default", "plugin"}, {"cli", "env"}, {"yaml"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected layers: got: %v, want: %v", got, want)
+	}
+
+	top.Connect(def, yaml)
+	if _, err := top.Layers(); err == nil {
+		t.Fatalf("Expected an error from a cycled graph")
+	}
+}
+
+func TestTopology_Reverse(t *testing.T) {
+	cli, yaml := newTestNode("cli"), newTestNode("yaml")
+	top := NewTopology(cli, yaml)
+	top.Connect(yaml, cli)
+
+	rev := top.Reverse()
+	sorted, err := rev.Sort()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if got, want := nodeNames(sorted), []string{"yaml", "cli"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected reversed sort order: got: %v, want: %v", got, want)
+	}
+	if _, ok := top.Edges[TopologyEdge{From: yaml, To: cli}]; !ok {
+		t.Fatalf("The original topology is expected to stay intact")
+	}
+}
+
+func TestTopology_WriteDOT(t *testing.T) {
+	def, cli, yaml := newTestNode("default"), newTestNode("cli"), newTestNode("yaml")
+	top := NewTopology(def, cli, yaml)
+	top.Connect(cli, def)
+	top.Connect(yaml, cli)
+	top.Connect(yaml, def)
+
+	var buf strings.Builder
+	if err := top.WriteDOT(&buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	want := `digraph topology {
+	rankdir=BT;
+	{ rank=same; "default"; }
+	{ rank=same; "cli"; }
+	{ rank=same; "yaml"; }
+	"cli" -> "default";
+	"yaml" -> "cli";
+	"yaml" -> "default";
+}
+`
+	if got := buf.String(); got != want {
+		t.Fatalf("Unexpected DOT output: got: %s, want: %s", got, want)
+	}
+}
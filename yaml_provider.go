@@ -1,8 +1,11 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
+	"strconv"
+	"sync"
 
 	fsnotify "github.com/fsnotify/fsnotify"
 	yaml "gopkg.in/yaml.v2"
@@ -22,19 +25,35 @@ var readRaw = func(source string) (map[interface{}]interface{}, error) {
 }
 
 type YamlProvider struct {
+	name     string
 	weight   int
 	source   string
 	options  *YamlProviderOptions
 	watcher  *fsnotify.Watcher
 	registry map[string]Value
 	ready    chan struct{}
+	state    healthState
+	repo     *Repository
+	mx       sync.RWMutex
+
+	// pathFromRepo indicates the config file location is read from the
+	// repo on SetUp
+	pathFromRepo bool
 }
 
 type YamlProviderOptions struct {
+	// Instance is the provider instance name: the provider is named
+	// yaml:<Instance> (see ProviderName). Required to register multiple yaml
+	// providers in the same repository.
+	Instance string
+	// Watch enables the config file watcher: the file is re-read on every
+	// change and the changed keys are reported to the repository.
 	Watch bool
 }
 
 var _ Provider = (*YamlProvider)(nil)
+var _ ContextGetProvider = (*YamlProvider)(nil)
+var _ HealthProvider = (*YamlProvider)(nil)
 
 func NewYamlProvider(repo *Repository, weight int) (*YamlProvider, error) {
 	return NewYamlProviderWithOptions(repo, weight, &YamlProviderOptions{})
@@ -46,24 +65,41 @@ func NewYamlProviderWithOptions(repo *Repository, weight int, options *YamlProvi
 
 func NewYamlProviderFromSource(repo *Repository, weight int, options *YamlProviderOptions, source string) (*YamlProvider, error) {
 	prov := &YamlProvider{
-		source:   source,
-		weight:   weight,
-		options:  options,
-		registry: make(map[string]Value),
-		ready:    make(chan struct{}),
+		name:         ProviderName("yaml", options.Instance),
+		source:       source,
+		weight:       weight,
+		pathFromRepo: len(source) == 0,
+		options:      options,
+		registry:     make(map[string]Value),
+		ready:        make(chan struct{}),
+	}
+	if err := repo.RegisterNewProvider(prov); err != nil {
+		return nil, err
 	}
-	repo.RegisterProvider(prov)
 	return prov, nil
 }
 
-func (yp *YamlProvider) Name() string      { return "yaml" }
-func (yp *YamlProvider) Depends() []string { return []string{"cli", "env"} }
-func (yp *YamlProvider) Weight() int       { return yp.weight }
+func (yp *YamlProvider) Name() string { return yp.name }
+func (yp *YamlProvider) Weight() int  { return yp.weight }
+
+// Depends returns the list of provider dependencies. If the config file
+// location is read from the repo (see CfgPathKey), the provider depends on cli
+// (hard) and env (soft: it might provide the location too). If the location
+// is provided explicitly, both dependencies are soft: they only define the
+// set up order.
+func (yp *YamlProvider) Depends() []string {
+	if yp.pathFromRepo {
+		return []string{"cli", SoftDependency("env")}
+	}
+	return []string{SoftDependency("cli"), SoftDependency("env")}
+}
 
-func (yp *YamlProvider) SetUp(repo *Repository) error {
+func (yp *YamlProvider) SetUp(repo *Repository) (err error) {
 	defer close(yp.ready)
+	defer func() { yp.state.loaded(err) }()
+	yp.repo = repo
 
-	if len(yp.source) == 0 {
+	if yp.pathFromRepo {
 		source, ok := repo.Get(NewKey(CfgPathKey))
 		if !ok {
 			return fmt.Errorf("Failed to get yaml config path from repo")
@@ -76,24 +112,20 @@ func (yp *YamlProvider) SetUp(repo *Repository) error {
 	// }
 
 	if yp.options.Watch {
-		watcher, err := fsnotify.NewWatcher()
-		if err != nil {
-			return fmt.Errorf("failed to start a yaml watcher: %s", err)
+		if err := yp.startWatch(); err != nil {
+			return err
 		}
-		if err := watcher.Add(yp.source); err != nil {
-			return fmt.Errorf("failed to add a new watchable file %q: %s", yp.source, err)
-		}
-		yp.watcher = watcher
-
-		go yp.watch()
 	}
 
 	rawData, err := readRaw(yp.source)
 	if err != nil {
 		return err
 	}
-	for k, v := range flatten(rawData) {
-		yp.registry[k] = v
+	registry := flatten(rawData)
+	yp.mx.Lock()
+	yp.registry = registry
+	yp.mx.Unlock()
+	for k := range registry {
 		if repo != nil {
 			if err := repo.RegisterKey(NewKey(k), yp); err != nil {
 				return err
@@ -104,31 +136,42 @@ func (yp *YamlProvider) SetUp(repo *Repository) error {
 	return nil
 }
 
+// flatten converts the yaml structure to a flat key-value map. Lists are
+// flattened to indexed keys: a list under key `links` produces keys
+// `links.0`, `links.1` etc. so the items could be overridden individually.
+// An empty list is kept as a leaf value (an empty []Value).
 func flatten(in map[interface{}]interface{}) map[string]Value {
 	out := make(map[string]Value)
 	for k, v := range in {
-		if vmap, ok := v.(map[interface{}]interface{}); ok {
-			for sk, sv := range flatten(vmap) {
-				out[k.(string)+KeySepCh+sk] = Value(sv)
-			}
-		} else {
-			out[k.(string)] = Value(v)
-		}
+		flattenValue(k.(string), v, out)
 	}
 	return out
 }
 
-func (yp *YamlProvider) watch() {
-	for event := range yp.watcher.Events {
-		fmt.Printf("Received a fsnotify event: %#v", event)
-		//TODO (olegs): not implemented
-		// if event.Op&fsnotify.Write != 1 {
-		// 	continue
-		// }
+func flattenValue(key string, v interface{}, out map[string]Value) {
+	switch vv := v.(type) {
+	case map[interface{}]interface{}:
+		for sk, sv := range vv {
+			flattenValue(key+KeySepCh+sk.(string), sv, out)
+		}
+	case []interface{}:
+		if len(vv) == 0 {
+			// The same type the non-empty lists are assembled into
+			out[key] = []Value{}
+			return
+		}
+		for ix, sv := range vv {
+			flattenValue(key+KeySepCh+strconv.Itoa(ix), sv, out)
+		}
+	default:
+		out[key] = Value(v)
 	}
 }
 
+// TearDown stops the config file watcher (if any) and resets the provider
+// health: the provider is not ready anymore.
 func (yp *YamlProvider) TearDown(repo *Repository) error {
+	yp.state.reset()
 	if yp.watcher != nil {
 		if err := yp.watcher.Close(); err != nil {
 			return fmt.Errorf("failed to terminate the yaml watcher: %q", err)
@@ -137,10 +180,30 @@ func (yp *YamlProvider) TearDown(repo *Repository) error {
 	return nil
 }
 
+// Get returns the value from the yaml registry.
+// Never blocks: returns nothing until the provider is set up.
 func (yp *YamlProvider) Get(key Key) (*KeyValue, bool) {
-	<-yp.ready
+	if !isReady(yp.ready) {
+		return nil, false
+	}
+	return yp.GetContext(context.Background(), key)
+}
+
+// GetContext is the same as Get, but waits for the provider to get ready
+// until the context is done. A context which is never done does not wait.
+func (yp *YamlProvider) GetContext(ctx context.Context, key Key) (*KeyValue, bool) {
+	if !waitReady(ctx, yp.ready) {
+		return nil, false
+	}
+	yp.mx.RLock()
+	defer yp.mx.RUnlock()
 	if v, ok := yp.registry[key.String()]; ok {
 		return &KeyValue{Key: key, Value: v}, ok
 	}
 	return nil, false
 }
+
+// Health returns the provider health report.
+func (yp *YamlProvider) Health() ProviderHealth {
+	return yp.state.health(yp.ready)
+}
@@ -69,7 +69,8 @@ func TestYamlProviderSetUp(t *testing.T) {
 				"components.tcp_sink_7222.module",
 				"components.fanout.module",
 				"pipeline.udp_rcv.connect",
-				"pipeline.fanout.links",
+				"pipeline.fanout.links.0",
+				"pipeline.fanout.links.1",
 			},
 		},
 	}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	fsnotify "github.com/fsnotify/fsnotify"
+)
+
+// startWatch starts the config file watcher: the file is reloaded on every
+// change.
+func (yp *YamlProvider) startWatch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start a yaml watcher: %s", err)
+	}
+	if err := watcher.Add(yp.source); err != nil {
+		return fmt.Errorf("failed to add a new watchable file %q: %s", yp.source, err)
+	}
+	yp.watcher = watcher
+
+	go yp.watch()
+
+	return nil
+}
+
+func (yp *YamlProvider) watch() {
+	for {
+		select {
+		case event, ok := <-yp.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				// Editors often replace the file instead of writing
+				// to it: the watch should be re-established.
+				if err := yp.watcher.Add(yp.source); err != nil {
+					yp.repo.Emit(Event{
+						Type:     EventReloadFailed,
+						Provider: yp.Name(),
+						Err:      fmt.Errorf("failed to re-watch yaml config file %q: %w", yp.source, err),
+					})
+					continue
+				}
+			} else if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			// The outcome is reported by reload itself
+			_ = yp.reload()
+		case err, ok := <-yp.watcher.Errors:
+			if !ok {
+				return
+			}
+			yp.repo.Emit(Event{
+				Type:     EventReloadFailed,
+				Provider: yp.Name(),
+				Err:      fmt.Errorf("yaml config file watcher error: %w", err),
+			})
+		}
+	}
+}
+
+// reload re-reads the config file and replaces the provider registry.
+// New keys are registered in the repo, removed keys are unregistered.
+// Changed and new keys are reported to the repo as changed. The outcome is
+// reflected in the provider health: a failed reload makes the served values
+// stale. The reload is reported to the repo observer.
+func (yp *YamlProvider) reload() (err error) {
+	start := time.Now()
+	yp.repo.Emit(Event{Type: EventReloadStarted, Provider: yp.Name(), Time: start})
+	defer func() {
+		yp.state.loaded(err)
+		typ := EventReloadSucceeded
+		if err != nil {
+			typ = EventReloadFailed
+		}
+		yp.repo.Emit(Event{Type: typ, Provider: yp.Name(), Err: err, Duration: time.Since(start)})
+	}()
+	rawData, err := readRaw(yp.source)
+	if err != nil {
+		return err
+	}
+	registry := flatten(rawData)
+
+	// The registry is replaced as a whole: a concurrent snapshot never
+	// mixes the old and the new values
+	var prev map[string]Value
+	yp.repo.Change(func() {
+		yp.mx.Lock()
+		prev = yp.registry
+		yp.registry = registry
+		yp.mx.Unlock()
+	})
+
+	changed := make([]Key, 0)
+	for k, v := range registry {
+		pv, ok := prev[k]
+		if !ok {
+			if err := yp.repo.RegisterKey(NewKey(k), yp); err != nil {
+				return err
+			}
+		}
+		if !ok || !reflect.DeepEqual(pv, v) {
+			changed = append(changed, NewKey(k))
+		}
+	}
+	for k := range prev {
+		if _, ok := registry[k]; !ok {
+			if err := yp.repo.UnregisterKey(NewKey(k), yp); err != nil {
+				return err
+			}
+		}
+	}
+	if len(changed) > 0 {
+		yp.repo.ReportChange(yp, changed...)
+	}
+
+	return nil
+}
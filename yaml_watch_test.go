@@ -0,0 +1,117 @@
+package config
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestYamlProviderReload(t *testing.T) {
+	src := []byte("system:\n  maxprocs: 4\n  admin:\n    enabled: true\n")
+
+	// Redefining the original value
+	oldReadRaw := readRaw
+	defer func() { readRaw = oldReadRaw }()
+	readRaw = func(source string) (map[interface{}]interface{}, error) {
+		out := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(src, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	repo := NewRepositoryWithOptions(&RepositoryOptions{Cache: true})
+	prov, err := NewYamlProviderFromSource(repo, 0, &YamlProviderOptions{}, "dummy.dummy")
+	if err != nil {
+		t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+	}
+	if err := prov.SetUp(repo); err != nil {
+		t.Fatalf("Failed to set up yaml provider: %s", err)
+	}
+
+	want := map[string]Value{"maxprocs": 4, "admin": map[string]Value{"enabled": true}}
+	if got, _ := repo.Get(NewKey("system")); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected value for key %q: got: %#v, want: %#v", "system", got, want)
+	}
+
+	gen := repo.Generation()
+	src = []byte("system:\n  maxprocs: 8\n  logfile: /var/log/app.log\n")
+	if err := prov.reload(); err != nil {
+		t.Fatalf("Failed to reload yaml provider: %s", err)
+	}
+	if repo.Generation() == gen {
+		t.Fatalf("Expected repo generation to change after a reload")
+	}
+
+	want = map[string]Value{"maxprocs": 8, "logfile": "/var/log/app.log"}
+	if got, _ := repo.Get(NewKey("system")); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Unexpected value for key %q: got: %#v, want: %#v", "system", got, want)
+	}
+}
+
+func TestYamlProviderReloadSnapshot(t *testing.T) {
+	sources := [][]byte{
+		[]byte("db:\n  host: a.local\n  port: 1\n"),
+		[]byte("db:\n  host: b.local\n  port: 2\n"),
+	}
+	var mx sync.Mutex
+	next := 0
+
+	// Redefining the original value
+	oldReadRaw := readRaw
+	defer func() { readRaw = oldReadRaw }()
+	readRaw = func(source string) (map[interface{}]interface{}, error) {
+		mx.Lock()
+		src := sources[next%len(sources)]
+		next++
+		mx.Unlock()
+		out := make(map[interface{}]interface{})
+		if err := yaml.Unmarshal(src, &out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+
+	repo := NewRepository()
+	prov, err := NewYamlProviderFromSource(repo, 0, &YamlProviderOptions{}, "dummy.dummy")
+	if err != nil {
+		t.Fatalf("Failed to initialize a new yaml provider: %s", err)
+	}
+	if err := prov.SetUp(repo); err != nil {
+		t.Fatalf("Failed to set up yaml provider: %s", err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := prov.reload(); err != nil {
+				t.Errorf("Failed to reload yaml provider: %s", err)
+				return
+			}
+		}
+	}()
+
+	consistent := map[Value]Value{"a.local": 1, "b.local": 2}
+	for ix := 0; ix < 1000; ix++ {
+		snap := repo.Snapshot()
+		host, _ := snap.Get(NewKey("db.host"))
+		port, _ := snap.Get(NewKey("db.port"))
+		if consistent[host] != port {
+			close(done)
+			wg.Wait()
+			t.Fatalf("Inconsistent snapshot: host: %#v, port: %#v", host, port)
+		}
+	}
+	close(done)
+	wg.Wait()
+}